@@ -0,0 +1,244 @@
+package gocent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Centrifugo reply error codes considered temporary by bulk operations.
+const (
+	errorCodeInternal        = 100
+	errorCodeNotAvailable    = 108
+	errorCodeTooManyRequests = 111
+)
+
+// BulkConfig configures bulk operations.
+type BulkConfig struct {
+	// BatchSize is a maximal number of commands in one Pipe. Zero value
+	// means 100.
+	BatchSize int
+	// Concurrency is a maximal number of Pipes sent at the same time. Zero
+	// value means 4.
+	Concurrency int
+	// Retries is a number of additional attempts for items failed with
+	// temporary error, only failed items of batch are sent again.
+	Retries int
+	// RetryDelay is a delay before sending failed items again. Zero value
+	// means 100 milliseconds.
+	RetryDelay time.Duration
+	// Progress when set called after every batch is processed. Calls are
+	// not concurrent.
+	Progress func(progress BulkProgress)
+}
+
+// BulkProgress describes progress of bulk operation.
+type BulkProgress struct {
+	// Processed is a number of items processed so far.
+	Processed int
+	// Failed is a number of processed items which failed.
+	Failed int
+}
+
+// BulkItem is a result of processing single item of bulk operation.
+type BulkItem struct {
+	// Index of item in input.
+	Index int
+	// Value of item, user ID for BulkDisconnect and BulkUnsubscribe.
+	Value string
+	// Attempts is a number of times item was sent.
+	Attempts int
+	// Err is an error of last attempt, nil on success.
+	Err error
+}
+
+// BulkReport is a result of bulk operation.
+type BulkReport struct {
+	// Items contains results of processed items in input order.
+	Items []BulkItem
+	// Succeeded is a number of items processed successfully.
+	Succeeded int
+	// Failed is a number of items failed.
+	Failed int
+}
+
+// Failures returns failed items.
+func (r BulkReport) Failures() []BulkItem {
+	var failures []BulkItem
+	for _, item := range r.Items {
+		if item.Err != nil {
+			failures = append(failures, item)
+		}
+	}
+	return failures
+}
+
+// StringIterator returns iterator over values to pass into bulk operations.
+func StringIterator(values []string) func() (string, bool) {
+	var i int
+	return func() (string, bool) {
+		if i >= len(values) {
+			return "", false
+		}
+		i++
+		return values[i-1], true
+	}
+}
+
+// BulkDisconnect disconnects users returned by next until it returns false,
+// see BulkConfig. Error is returned only if ctx is done before all users
+// were sent, report then contains items sent so far. Failures of separate
+// items are reported in BulkReport.
+func (c *Client) BulkDisconnect(ctx context.Context, next func() (string, bool), config BulkConfig, opts ...DisconnectOption) (BulkReport, error) {
+	return c.bulk(ctx, next, config, func(pipe *Pipe, user string) error {
+		return pipe.AddDisconnect(user, opts...)
+	})
+}
+
+// BulkUnsubscribe unsubscribes users returned by next from channel, works in
+// the same way as BulkDisconnect.
+func (c *Client) BulkUnsubscribe(ctx context.Context, channel string, next func() (string, bool), config BulkConfig, opts ...UnsubscribeOption) (BulkReport, error) {
+	return c.bulk(ctx, next, config, func(pipe *Pipe, user string) error {
+		return pipe.AddUnsubscribe(channel, user, opts...)
+	})
+}
+
+func (c *Client) bulk(ctx context.Context, next func() (string, bool), config BulkConfig, add func(pipe *Pipe, value string) error) (BulkReport, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 100 * time.Millisecond
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		progress BulkProgress
+		batches  [][]BulkItem
+		err      error
+	)
+	sem := make(chan struct{}, config.Concurrency)
+	var index int
+loop:
+	for {
+		batch := make([]BulkItem, 0, config.BatchSize)
+		for len(batch) < config.BatchSize {
+			value, ok := next()
+			if !ok {
+				break
+			}
+			batch = append(batch, BulkItem{Index: index, Value: value})
+			index++
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		}
+		batches = append(batches, batch)
+		wg.Add(1)
+		go func(batch []BulkItem) {
+			defer wg.Done()
+			// Slot released after progress reported, so cancelling ctx in
+			// Progress stops following batches.
+			defer func() { <-sem }()
+			c.sendBulkBatch(ctx, batch, config, add)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, item := range batch {
+				progress.Processed++
+				if item.Err != nil {
+					progress.Failed++
+				}
+			}
+			if config.Progress != nil {
+				config.Progress(progress)
+			}
+		}(batch)
+		if len(batch) < config.BatchSize {
+			break
+		}
+	}
+	wg.Wait()
+
+	report := BulkReport{Items: make([]BulkItem, 0, index)}
+	for _, batch := range batches {
+		report.Items = append(report.Items, batch...)
+	}
+	report.Failed = progress.Failed
+	report.Succeeded = progress.Processed - progress.Failed
+	return report, err
+}
+
+// sendBulkBatch sends items in one Pipe, retrying items failed with
+// temporary errors. Results are written into items.
+func (c *Client) sendBulkBatch(ctx context.Context, items []BulkItem, config BulkConfig, add func(pipe *Pipe, value string) error) {
+	pending := make([]int, len(items))
+	for i := range items {
+		pending[i] = i
+	}
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(config.RetryDelay):
+			case <-ctx.Done():
+				for _, i := range pending {
+					items[i].Err = ctx.Err()
+				}
+				return
+			}
+		}
+		pipe := c.Pipe()
+		sent := make([]int, 0, len(pending))
+		for _, i := range pending {
+			if err := add(pipe, items[i].Value); err != nil {
+				items[i].Err = err
+				continue
+			}
+			sent = append(sent, i)
+		}
+		if len(sent) == 0 {
+			return
+		}
+		replies, err := c.SendPipe(ctx, pipe)
+		retry := attempt < config.Retries && ctx.Err() == nil
+		pending = pending[:0]
+		for j, i := range sent {
+			items[i].Attempts++
+			items[i].Err = err
+			if err == nil && replies[j].Error != nil {
+				items[i].Err = replies[j].Error
+			}
+			if items[i].Err != nil && retry && isTemporary(items[i].Err) {
+				pending = append(pending, i)
+			}
+		}
+	}
+}
+
+// isTemporary checks whether command failed with err may succeed later.
+func isTemporary(err error) bool {
+	var replyErr *Error
+	if errors.As(err, &replyErr) {
+		switch replyErr.Code {
+		case errorCodeInternal, errorCodeNotAvailable, errorCodeTooManyRequests:
+			return true
+		}
+		return false
+	}
+	var rateErr ErrRateLimited
+	var concurrencyErr ErrConcurrencyLimited
+	return isRetryable(err) || errors.As(err, &rateErr) || errors.As(err, &concurrencyErr)
+}
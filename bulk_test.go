@@ -0,0 +1,154 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkServer fails commands for user "bad" permanently and for user "flaky"
+// on first attempt, tracks maximal number of concurrent requests.
+type bulkServer struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	sizes       []int
+	flaky       bool
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.sizes = append(s.sizes, len(lines))
+	s.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	for _, line := range lines {
+		var cmd struct {
+			Params struct {
+				User    string `json:"user"`
+				Channel string `json:"channel"`
+			} `json:"params"`
+		}
+		_ = json.Unmarshal(line, &cmd)
+		s.mu.Lock()
+		reply := `{"result":{}}`
+		switch {
+		case cmd.Params.User == "bad":
+			reply = `{"error":{"code":102,"message":"unknown channel"}}`
+		case cmd.Params.User == "flaky" && !s.flaky:
+			s.flaky = true
+			reply = `{"error":{"code":100,"message":"internal server error"}}`
+		}
+		s.mu.Unlock()
+		_, _ = w.Write([]byte(reply + "\n"))
+	}
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+}
+
+func TestClientBulkDisconnect(t *testing.T) {
+	s := &bulkServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := New(Config{Addr: server.URL})
+
+	users := make([]string, 95)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+	}
+	users[10], users[50] = "bad", "flaky"
+	var progress []BulkProgress
+	report, err := c.BulkDisconnect(context.Background(), StringIterator(users), BulkConfig{
+		BatchSize:   10,
+		Concurrency: 3,
+		Retries:     1,
+		RetryDelay:  time.Millisecond,
+		Progress: func(p BulkProgress) {
+			progress = append(progress, p)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Items) != 95 || report.Succeeded != 94 || report.Failed != 1 {
+		t.Fatalf("unexpected report: %d items, %d succeeded, %d failed", len(report.Items), report.Succeeded, report.Failed)
+	}
+	for i, item := range report.Items {
+		if item.Index != i || item.Value != users[i] {
+			t.Fatalf("unexpected item %d: %+v", i, item)
+		}
+	}
+	failures := report.Failures()
+	var replyErr *Error
+	if len(failures) != 1 || failures[0].Value != "bad" || failures[0].Attempts != 1 || !errors.As(failures[0].Err, &replyErr) {
+		t.Fatalf("unexpected failures %+v", failures)
+	}
+	if item := report.Items[50]; item.Err != nil || item.Attempts != 2 {
+		t.Fatalf("expected flaky item retried, got %+v", item)
+	}
+	if len(progress) != 10 || progress[9] != (BulkProgress{Processed: 95, Failed: 1}) {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxInFlight > 3 {
+		t.Fatalf("concurrency exceeded: %d", s.maxInFlight)
+	}
+	// 10 batches and one retry of single item.
+	if len(s.sizes) != 11 {
+		t.Fatalf("unexpected requests %v", s.sizes)
+	}
+}
+
+func TestClientBulkUnsubscribeCancel(t *testing.T) {
+	s := &bulkServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := New(Config{Addr: server.URL, Channels: &ChannelConfig{}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var count int
+	next := func() (string, bool) {
+		count++
+		return fmt.Sprintf("user%d", count), true
+	}
+	report, err := c.BulkUnsubscribe(ctx, "chat", next, BulkConfig{
+		BatchSize:   5,
+		Concurrency: 1,
+		Progress: func(p BulkProgress) {
+			if p.Processed >= 20 {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if len(report.Items) < 20 || report.Failed != 0 {
+		t.Fatalf("unexpected report: %d items, %d failed", len(report.Items), report.Failed)
+	}
+
+	// Invalid channel fails every item without sending.
+	report, err = c.BulkUnsubscribe(context.Background(), "", StringIterator([]string{"1", "2"}), BulkConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 2 || report.Items[0].Attempts != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
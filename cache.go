@@ -0,0 +1,256 @@
+package gocent
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures CachedClient.
+type CacheConfig struct {
+	// TTL of results per method name. Methods presence, presence_stats,
+	// channels and info can be cached, methods without TTL are not cached.
+	TTL map[string]time.Duration
+	// MaxEntries is a maximum number of cached results, least recently used
+	// results evicted first. Zero value means 1000.
+	MaxEntries int
+	// StaleWhileRevalidate allows to return expired result during this period
+	// after expiration while it's refreshed in background. Zero value means
+	// expired results are never returned.
+	StaleWhileRevalidate time.Duration
+}
+
+// CachedClient is a Client which caches results of read methods. Concurrent
+// identical requests are deduplicated. Subscribe, Unsubscribe and Disconnect
+// called through CachedClient invalidate affected results, use Invalidate
+// methods when changes are made in other ways. Cached results are shared so
+// must not be modified.
+type CachedClient struct {
+	*Client
+	config CacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	calls   map[string]*cacheCall
+	// generation changes on every invalidation, so results of requests
+	// started before invalidation are not cached.
+	generation uint64
+}
+
+type cacheEntry struct {
+	key        string
+	method     string
+	channel    string
+	value      interface{}
+	expires    time.Time
+	refreshing bool
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewCachedClient creates CachedClient.
+func NewCachedClient(c *Client, config CacheConfig) *CachedClient {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	return &CachedClient{
+		Client:  c,
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		calls:   make(map[string]*cacheCall),
+	}
+}
+
+// Presence returns cached presence of channel.
+func (c *CachedClient) Presence(ctx context.Context, channel string) (PresenceResult, error) {
+	value, err := c.get(ctx, "presence", channel, func(ctx context.Context) (interface{}, error) {
+		return c.Client.Presence(ctx, channel)
+	})
+	if err != nil {
+		return PresenceResult{}, err
+	}
+	return value.(PresenceResult), nil
+}
+
+// PresenceStats returns cached presence stats of channel.
+func (c *CachedClient) PresenceStats(ctx context.Context, channel string) (PresenceStatsResult, error) {
+	value, err := c.get(ctx, "presence_stats", channel, func(ctx context.Context) (interface{}, error) {
+		return c.Client.PresenceStats(ctx, channel)
+	})
+	if err != nil {
+		return PresenceStatsResult{}, err
+	}
+	return value.(PresenceStatsResult), nil
+}
+
+// Channels returns cached active channels.
+func (c *CachedClient) Channels(ctx context.Context, opts ...ChannelsOption) (ChannelsResult, error) {
+	options := &ChannelsOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	value, err := c.get(ctx, "channels", options.Pattern, func(ctx context.Context) (interface{}, error) {
+		return c.Client.Channels(ctx, opts...)
+	})
+	if err != nil {
+		return ChannelsResult{}, err
+	}
+	return value.(ChannelsResult), nil
+}
+
+// Info returns cached information about running nodes.
+func (c *CachedClient) Info(ctx context.Context) (InfoResult, error) {
+	value, err := c.get(ctx, "info", "", func(ctx context.Context) (interface{}, error) {
+		return c.Client.Info(ctx)
+	})
+	if err != nil {
+		return InfoResult{}, err
+	}
+	return value.(InfoResult), nil
+}
+
+// Subscribe subscribes user to channel and invalidates cached results
+// related to channel.
+func (c *CachedClient) Subscribe(ctx context.Context, channel, user string, opts ...SubscribeOption) error {
+	defer c.InvalidateChannel(channel)
+	return c.Client.Subscribe(ctx, channel, user, opts...)
+}
+
+// Unsubscribe unsubscribes user from channel and invalidates cached results
+// related to channel.
+func (c *CachedClient) Unsubscribe(ctx context.Context, channel, user string, opts ...UnsubscribeOption) error {
+	defer c.InvalidateChannel(channel)
+	return c.Client.Unsubscribe(ctx, channel, user, opts...)
+}
+
+// Disconnect disconnects user and invalidates all cached results since user
+// could be subscribed to any channel.
+func (c *CachedClient) Disconnect(ctx context.Context, user string, opts ...DisconnectOption) error {
+	defer c.InvalidateAll()
+	return c.Client.Disconnect(ctx, user, opts...)
+}
+
+// Invalidate removes cached result of method for channel (pattern for
+// channels method, empty for info).
+func (c *CachedClient) Invalidate(method, channel string) {
+	c.invalidate(func(e *cacheEntry) bool {
+		return e.method == method && e.channel == channel
+	})
+}
+
+// InvalidateChannel removes cached presence and presence stats of channel and
+// all cached channels results.
+func (c *CachedClient) InvalidateChannel(channel string) {
+	c.invalidate(func(e *cacheEntry) bool {
+		return e.channel == channel || e.method == "channels"
+	})
+}
+
+// InvalidateAll removes all cached results.
+func (c *CachedClient) InvalidateAll() {
+	c.invalidate(func(*cacheEntry) bool { return true })
+}
+
+func (c *CachedClient) invalidate(match func(e *cacheEntry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key, el := range c.entries {
+		if match(el.Value.(*cacheEntry)) {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *CachedClient) get(ctx context.Context, method, channel string, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ttl, ok := c.config.TTL[method]
+	if !ok || ttl <= 0 {
+		return fetch(ctx)
+	}
+	key := method + "\x00" + channel
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok {
+			entry := el.Value.(*cacheEntry)
+			value, now := entry.value, time.Now()
+			if now.Before(entry.expires) {
+				c.lru.MoveToFront(el)
+				c.mu.Unlock()
+				return value, nil
+			}
+			if now.Before(entry.expires.Add(c.config.StaleWhileRevalidate)) {
+				c.lru.MoveToFront(el)
+				if _, inFlight := c.calls[key]; !entry.refreshing && !inFlight {
+					entry.refreshing = true
+					c.startCall(context.Background(), key, method, channel, ttl, fetch)
+				}
+				c.mu.Unlock()
+				return value, nil
+			}
+		}
+		call, follower := c.calls[key]
+		if !follower {
+			call = c.startCall(ctx, key, method, channel, ttl, fetch)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if follower && call.err != nil && ctx.Err() == nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+			// Request failed because context of other caller was done.
+			continue
+		}
+		return call.value, call.err
+	}
+}
+
+// startCall fetches value in background, must be called with mu held.
+func (c *CachedClient) startCall(ctx context.Context, key, method, channel string, ttl time.Duration, fetch func(ctx context.Context) (interface{}, error)) *cacheCall {
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	generation := c.generation
+	go func() {
+		value, err := fetch(ctx)
+		c.mu.Lock()
+		call.value, call.err = value, err
+		delete(c.calls, key)
+		if el, ok := c.entries[key]; ok {
+			el.Value.(*cacheEntry).refreshing = false
+		}
+		if err == nil && generation == c.generation {
+			c.store(key, method, channel, value, ttl)
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// store puts value into cache, must be called with mu held.
+func (c *CachedClient) store(key, method, channel string, value interface{}, ttl time.Duration) {
+	expires := time.Now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.value, entry.expires = value, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, method: method, channel: channel, value: value, expires: expires})
+	for c.lru.Len() > c.config.MaxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).key)
+	}
+}
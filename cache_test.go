@@ -0,0 +1,141 @@
+package gocent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCountingServer replies to presence_stats with number of presence_stats
+// requests received so far as num_users.
+func newCountingServer(delay time.Duration) (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cmd Command
+		_ = json.NewDecoder(r.Body).Decode(&cmd)
+		time.Sleep(delay)
+		if cmd.Method == "presence_stats" {
+			_, _ = fmt.Fprintf(w, `{"result":{"num_users":%d}}`, atomic.AddInt32(&count, 1))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	return server, &count
+}
+
+func TestCachedClient(t *testing.T) {
+	server, count := newCountingServer(0)
+	defer server.Close()
+	c := NewCachedClient(New(Config{Addr: server.URL}), CacheConfig{
+		TTL:        map[string]time.Duration{"presence_stats": time.Minute},
+		MaxEntries: 2,
+	})
+	ctx := context.Background()
+	stats := func(channel string) int32 {
+		t.Helper()
+		result, err := c.PresenceStats(ctx, channel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.NumUsers
+	}
+
+	if stats("a") != 1 || stats("a") != 1 {
+		t.Fatal("expected cached result")
+	}
+	if err := c.Unsubscribe(ctx, "a", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if stats("a") != 2 {
+		t.Fatal("expected result invalidated after unsubscribe")
+	}
+
+	// Least recently used channel evicted.
+	stats("b")
+	stats("a")
+	stats("c")
+	if stats("a") != 2 || stats("b") != 5 {
+		t.Fatalf("unexpected eviction, %d requests", atomic.LoadInt32(count))
+	}
+
+	c.Invalidate("presence_stats", "a")
+	if stats("a") != 6 {
+		t.Fatal("expected result invalidated")
+	}
+
+	// Methods without TTL are not cached.
+	before := atomic.LoadInt32(count)
+	_, _ = c.Client.Info(ctx)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Info(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(count) != before {
+		t.Fatal("unexpected presence_stats requests")
+	}
+}
+
+func TestCachedClientSingleflight(t *testing.T) {
+	server, count := newCountingServer(20 * time.Millisecond)
+	defer server.Close()
+	c := NewCachedClient(New(Config{Addr: server.URL}), CacheConfig{
+		TTL: map[string]time.Duration{"presence_stats": time.Minute},
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := c.PresenceStats(context.Background(), "chat")
+			if err != nil || result.NumUsers != 1 {
+				t.Errorf("unexpected result %v, error %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(count); n != 1 {
+		t.Fatalf("expected one request, got %d", n)
+	}
+}
+
+func TestCachedClientStaleWhileRevalidate(t *testing.T) {
+	server, count := newCountingServer(0)
+	defer server.Close()
+	c := NewCachedClient(New(Config{Addr: server.URL}), CacheConfig{
+		TTL:                  map[string]time.Duration{"presence_stats": 10 * time.Millisecond},
+		StaleWhileRevalidate: time.Minute,
+	})
+	ctx := context.Background()
+	if result, _ := c.PresenceStats(ctx, "chat"); result.NumUsers != 1 {
+		t.Fatalf("unexpected result %v", result)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// Stale result returned while refreshed in background.
+	if result, _ := c.PresenceStats(ctx, "chat"); result.NumUsers != 1 {
+		t.Fatalf("expected stale result, got %v", result)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		result, err := c.PresenceStats(ctx, "chat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.NumUsers == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("result not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(count); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
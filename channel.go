@@ -0,0 +1,174 @@
+package gocent
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidChannel returned when channel does not match ChannelConfig.
+type ErrInvalidChannel struct {
+	Channel string
+	Reason  string
+}
+
+func (e ErrInvalidChannel) Error() string {
+	return fmt.Sprintf("invalid channel %q: %s", e.Channel, e.Reason)
+}
+
+// ChannelConfig describes channel naming conventions of Centrifugo setup.
+type ChannelConfig struct {
+	// NamespaceSeparator separates namespace from channel name. Zero value
+	// means ":".
+	NamespaceSeparator string
+	// UserBoundary starts list of users allowed to subscribe to channel.
+	// Zero value means "#".
+	UserBoundary string
+	// UserSeparator separates users in user-limited channel. Zero value
+	// means ",".
+	UserSeparator string
+	// PrivatePrefix marks private channels. Zero value means channels have
+	// no private prefix.
+	PrivatePrefix string
+	// MaxLength of channel in bytes. Zero value means 255. For tenant client
+	// views limit applies to channel with tenant prefix, see WithTenant.
+	MaxLength int
+	// Namespaces when set limits namespaces channels may belong to. Empty
+	// string allows channels without namespace.
+	Namespaces []string
+}
+
+// Channel represents parts of channel name.
+type Channel struct {
+	// Private channel starts with ChannelConfig.PrivatePrefix.
+	Private bool
+	// Namespace of channel, empty for channels without namespace.
+	Namespace string
+	// Name of channel inside namespace.
+	Name string
+	// Users allowed to subscribe to user-limited channel.
+	Users []string
+}
+
+func (c ChannelConfig) namespaceSeparator() string {
+	if c.NamespaceSeparator == "" {
+		return ":"
+	}
+	return c.NamespaceSeparator
+}
+
+func (c ChannelConfig) userBoundary() string {
+	if c.UserBoundary == "" {
+		return "#"
+	}
+	return c.UserBoundary
+}
+
+func (c ChannelConfig) userSeparator() string {
+	if c.UserSeparator == "" {
+		return ","
+	}
+	return c.UserSeparator
+}
+
+func (c ChannelConfig) maxLength() int {
+	if c.MaxLength <= 0 {
+		return 255
+	}
+	return c.MaxLength
+}
+
+// Build returns channel name built from parts, for example Channel with
+// Namespace "chat", Name "dialog" and Users "1" and "2" results into
+// "chat:dialog#1,2".
+func (c ChannelConfig) Build(ch Channel) (string, error) {
+	var b strings.Builder
+	if ch.Private {
+		if c.PrivatePrefix == "" {
+			return "", ErrInvalidChannel{Channel: ch.Name, Reason: "private prefix not configured"}
+		}
+		b.WriteString(c.PrivatePrefix)
+	}
+	if ch.Namespace != "" {
+		b.WriteString(ch.Namespace)
+		b.WriteString(c.namespaceSeparator())
+	}
+	b.WriteString(ch.Name)
+	if len(ch.Users) > 0 {
+		b.WriteString(c.userBoundary())
+		b.WriteString(strings.Join(ch.Users, c.userSeparator()))
+	}
+	channel := b.String()
+	parsed, err := c.Parse(channel)
+	if err != nil {
+		return "", err
+	}
+	// Parts containing separators would be parsed differently.
+	if parsed.Namespace != ch.Namespace || parsed.Name != ch.Name || len(parsed.Users) != len(ch.Users) {
+		return "", ErrInvalidChannel{Channel: channel, Reason: "channel parts contain separators"}
+	}
+	return channel, nil
+}
+
+// Parse splits channel into parts and validates it.
+func (c ChannelConfig) Parse(channel string) (Channel, error) {
+	invalid := func(reason string) (Channel, error) {
+		return Channel{}, ErrInvalidChannel{Channel: channel, Reason: reason}
+	}
+	if channel == "" {
+		return invalid("empty channel")
+	}
+	if len(channel) > c.maxLength() {
+		return invalid(fmt.Sprintf("longer than %d bytes", c.maxLength()))
+	}
+	if !utf8.ValidString(channel) {
+		return invalid("not valid UTF-8")
+	}
+	var ch Channel
+	rest := channel
+	if c.PrivatePrefix != "" && strings.HasPrefix(rest, c.PrivatePrefix) {
+		ch.Private = true
+		rest = rest[len(c.PrivatePrefix):]
+	}
+	if i := strings.Index(rest, c.userBoundary()); i >= 0 {
+		for _, user := range strings.Split(rest[i+len(c.userBoundary()):], c.userSeparator()) {
+			if user == "" {
+				return invalid("empty user in user-limited channel")
+			}
+			ch.Users = append(ch.Users, user)
+		}
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, c.namespaceSeparator()); i >= 0 {
+		ch.Namespace, rest = rest[:i], rest[i+len(c.namespaceSeparator()):]
+		if ch.Namespace == "" {
+			return invalid("empty namespace")
+		}
+	}
+	if rest == "" {
+		return invalid("empty name")
+	}
+	ch.Name = rest
+	if len(c.Namespaces) > 0 && !containsString(c.Namespaces, ch.Namespace) {
+		if ch.Namespace == "" {
+			return invalid("namespace required")
+		}
+		return invalid(fmt.Sprintf("unknown namespace %q", ch.Namespace))
+	}
+	return ch, nil
+}
+
+// Validate checks that channel matches config.
+func (c ChannelConfig) Validate(channel string) error {
+	_, err := c.Parse(channel)
+	return err
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package gocent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChannelConfigParse(t *testing.T) {
+	config := ChannelConfig{PrivatePrefix: "$"}
+	testCases := []struct {
+		channel string
+		parsed  Channel
+		err     bool
+	}{
+		{channel: "chat", parsed: Channel{Name: "chat"}},
+		{channel: "ns:chat", parsed: Channel{Namespace: "ns", Name: "chat"}},
+		{channel: "ns:chat:1", parsed: Channel{Namespace: "ns", Name: "chat:1"}},
+		{channel: "dialog#1,2", parsed: Channel{Name: "dialog", Users: []string{"1", "2"}}},
+		{channel: "$ns:secret#42", parsed: Channel{Private: true, Namespace: "ns", Name: "secret", Users: []string{"42"}}},
+		{channel: "", err: true},
+		{channel: ":chat", err: true},
+		{channel: "ns:", err: true},
+		{channel: "chat#", err: true},
+		{channel: "chat#1,,2", err: true},
+		{channel: strings.Repeat("a", 256), err: true},
+		{channel: "\xff", err: true},
+	}
+	for _, tc := range testCases {
+		parsed, err := config.Parse(tc.channel)
+		if tc.err {
+			var invalid ErrInvalidChannel
+			if !errors.As(err, &invalid) {
+				t.Errorf("%q: expected ErrInvalidChannel, got %v", tc.channel, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.channel, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed, tc.parsed) {
+			t.Errorf("%q: expected %+v, got %+v", tc.channel, tc.parsed, parsed)
+		}
+	}
+}
+
+func TestChannelConfigCustom(t *testing.T) {
+	config := ChannelConfig{
+		NamespaceSeparator: "/",
+		UserBoundary:       "@",
+		UserSeparator:      ";",
+		MaxLength:          20,
+		Namespaces:         []string{"", "chat"},
+	}
+	channel, err := config.Build(Channel{Namespace: "chat", Name: "room", Users: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel != "chat/room@a;b" {
+		t.Fatalf("unexpected channel %q", channel)
+	}
+	if err := config.Validate("news/room"); err == nil {
+		t.Fatal("expected unknown namespace error")
+	}
+	if err := config.Validate("room"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate("chat/" + strings.Repeat("a", 16)); err == nil {
+		t.Fatal("expected max length error")
+	}
+}
+
+func TestChannelConfigBuild(t *testing.T) {
+	config := ChannelConfig{}
+	if _, err := config.Build(Channel{Name: "a#b"}); err == nil {
+		t.Fatal("expected error for name with user boundary")
+	}
+	if _, err := config.Build(Channel{Name: "chat", Users: []string{"1,2"}}); err == nil {
+		t.Fatal("expected error for user with separator")
+	}
+	if _, err := config.Build(Channel{Private: true, Name: "chat"}); err == nil {
+		t.Fatal("expected error without private prefix")
+	}
+	channel, err := ChannelConfig{PrivatePrefix: "$"}.Build(Channel{Private: true, Name: "chat"})
+	if err != nil || channel != "$chat" {
+		t.Fatalf("unexpected channel %q, error %v", channel, err)
+	}
+}
+
+func TestPipeChannelValidation(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := New(Config{Addr: server.URL, Channels: &ChannelConfig{Namespaces: []string{"chat"}}})
+
+	pipe := c.Pipe()
+	if err := pipe.AddPublish("chat:1", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	err := pipe.AddBroadcast([]string{"chat:1", "news:1"}, []byte(`{}`))
+	var invalid ErrInvalidChannel
+	if !errors.As(err, &invalid) || invalid.Channel != "news:1" {
+		t.Fatalf("expected invalid channel error, got %v", err)
+	}
+	if len(pipe.Commands()) != 1 {
+		t.Fatal("invalid command added to pipe")
+	}
+
+	if _, err := c.Publish(context.Background(), "news:1", []byte(`{}`)); !errors.As(err, &invalid) {
+		t.Fatalf("expected invalid channel error, got %v", err)
+	}
+	if _, err := c.Publish(context.Background(), "chat:1", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Channels of raw commands validated too.
+	for _, params := range []interface{}{
+		json.RawMessage(`{"channel":"news:1","data":{}}`),
+		map[string]json.RawMessage{"channels": json.RawMessage(`["chat:1","news:1"]`)},
+	} {
+		if err := pipe.AddCommand(Command{Method: "publish", Params: params}); !errors.As(err, &invalid) || invalid.Channel != "news:1" {
+			t.Fatalf("expected invalid channel error for %v, got %v", params, err)
+		}
+	}
+
+	// Length limit applies to channel with tenant prefix.
+	c = New(Config{Addr: server.URL, Channels: &ChannelConfig{MaxLength: 8}}).WithTenant("t")
+	if err := c.Pipe().AddPublish("chat", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Pipe().AddPublish("chat:12", []byte(`{}`)); !errors.As(err, &invalid) || invalid.Channel != "t.chat:12" {
+		t.Fatalf("expected invalid channel error, got %v", err)
+	}
+}
@@ -2,13 +2,18 @@
 package gocent
 
 import (
-	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +24,12 @@ var (
 	ErrPipeEmpty = errors.New("no commands in pipe")
 )
 
+const (
+	unixScheme = "unix://"
+	// defaultUnixPath is HTTP path of API used for Unix socket addresses.
+	defaultUnixPath = "/api"
+)
+
 // ErrStatusCode can be returned in case request to server resulted in wrong status code.
 type ErrStatusCode struct {
 	Code int
@@ -30,25 +41,91 @@ func (e ErrStatusCode) Error() string {
 
 // Config of client.
 type Config struct {
-	// Addr is Centrifugo API endpoint.
+	// Addr is Centrifugo API endpoint. Unix socket addresses like
+	// unix:///path/to.sock are supported, HTTP path is /api by default and can
+	// be set after colon: unix:///path/to.sock:/custom/api. Requests to Unix
+	// sockets use settings of HTTP client, which must use *http.Transport.
 	Addr string
+	// Addrs is a list of Centrifugo API endpoints. When set requests are
+	// distributed over endpoints in round-robin order and retried requests go
+	// to the next endpoint. Addr field of Config is ignored in this case.
+	Addrs []string
 	// GetAddr when set will be used before every API call to extract
-	// Centrifugo API endpoint. In this case Addr field of Config will be
-	// ignored. Nil value means using static Config.Addr field.
+	// Centrifugo API endpoint. In this case Addr and Addrs fields of Config will
+	// be ignored. Nil value means using static Config.Addr field.
 	GetAddr func() (string, error)
 	// Key is Centrifugo API key.
 	Key string
+	// Credentials when set will be used before every API call to get API keys.
+	// In this case Key field of Config will be ignored.
+	Credentials CredentialsProvider
 	// HTTPClient is a custom HTTP client to be used.
 	// If nil DefaultHTTPClient will be used.
 	HTTPClient *http.Client
+	// Timeout of HTTP request. Only used when HTTPClient is nil, zero value
+	// means timeout of DefaultHTTPClient.
+	Timeout time.Duration
+	// MaxIdleConnsPerHost of HTTP transport. Only used when HTTPClient is nil,
+	// zero value means value of DefaultHTTPClient transport.
+	MaxIdleConnsPerHost int
+	// TLS configures secure connections to Centrifugo. Only used when
+	// HTTPClient is nil.
+	TLS *TLSConfig
+	// DialContext allows to set custom function to establish connections.
+	// For Unix socket addresses it's called with "unix" network and socket
+	// path. Only used when HTTPClient is nil.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Compression when set enables compression of request bodies larger than
+	// CompressionThreshold, see GzipCompressor. Compressed responses are
+	// decoded transparently. Nil value means no compression.
+	Compression Compressor
+	// CompressionThreshold is a minimal size of request body to compress.
+	// Zero value means DefaultCompressionThreshold.
+	CompressionThreshold int
+	// RateLimiter when set is consulted before every API call, see
+	// NewRateLimiter. Nil value means no rate limiting.
+	RateLimiter RateLimiter
+	// ConcurrencyLimiter when set limits number of in-flight requests, see
+	// NewAIMDLimiter. Nil value means no limit.
+	ConcurrencyLimiter ConcurrencyLimiter
+	// Hedging when set enables hedged requests for read-only methods
+	// (presence, presence_stats, history, channels and info) if several Addrs
+	// configured. Write methods are never hedged.
+	Hedging *HedgeConfig
+	// Channels when set used to validate channels of commands added to Pipe
+	// so invalid channels fail before sending, see ChannelConfig. Nil value
+	// means channels are validated by server only.
+	Channels *ChannelConfig
+	// Retries is a number of additional attempts to send request failed with
+	// network error or with 5xx or 429 status code. Note that request may
+	// be processed by server even if network error returned, so retried publish
+	// may result into duplicate publication unless idempotency key used.
+	Retries int
 }
 
 // Client is API client for project registered in server.
 type Client struct {
 	endpoint    string
+	endpoints   []string
 	getEndpoint func() (string, error)
-	apiKey      string
+	credentials CredentialsProvider
 	httpClient  *http.Client
+	unixClient  *unixHTTPClient
+	retries     int
+	compressor  Compressor
+	threshold   int
+	rateLimiter RateLimiter
+	limiter     ConcurrencyLimiter
+	hedge       *HedgeConfig
+	latencies   *latencyWindow
+	channels    *ChannelConfig
+	tenant      *tenantScope
+	health      *endpointHealth
+	// counter for round-robin over endpoints, accessed atomically.
+	counter uint32
+	// lastKey is API key of last authorized request, tried first when
+	// provider returns several keys.
+	lastKey atomic.Value
 }
 
 // DefaultHTTPClient will be used by default for HTTP requests.
@@ -61,15 +138,178 @@ func New(c Config) *Client {
 	var httpClient *http.Client
 	if c.HTTPClient != nil {
 		httpClient = c.HTTPClient
+	} else if c.Timeout > 0 || c.MaxIdleConnsPerHost > 0 || c.TLS != nil || c.DialContext != nil {
+		httpClient = newHTTPClient(c)
 	} else {
 		httpClient = DefaultHTTPClient
 	}
+	threshold := c.CompressionThreshold
+	if threshold == 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	credentials := c.Credentials
+	if credentials == nil {
+		credentials = StaticCredentials(c.Key)
+	}
 	return &Client{
 		endpoint:    c.Addr,
+		endpoints:   c.Addrs,
 		getEndpoint: c.GetAddr,
-		apiKey:      c.Key,
+		credentials: credentials,
 		httpClient:  httpClient,
+		unixClient:  &unixHTTPClient{},
+		retries:     c.Retries,
+		compressor:  c.Compression,
+		threshold:   threshold,
+		rateLimiter: c.RateLimiter,
+		limiter:     c.ConcurrencyLimiter,
+		hedge:       c.Hedging,
+		latencies:   &latencyWindow{},
+		channels:    c.Channels,
+		health:      &endpointHealth{},
+	}
+}
+
+// clone returns client sharing transport and state of c, round-robin
+// counter of clone starts from zero.
+func (c *Client) clone() *Client {
+	clone := &Client{
+		endpoint:    c.endpoint,
+		endpoints:   c.endpoints,
+		getEndpoint: c.getEndpoint,
+		credentials: c.credentials,
+		httpClient:  c.httpClient,
+		unixClient:  c.unixClient,
+		retries:     c.retries,
+		compressor:  c.compressor,
+		threshold:   c.threshold,
+		rateLimiter: c.rateLimiter,
+		limiter:     c.limiter,
+		hedge:       c.hedge,
+		latencies:   c.latencies,
+		channels:    c.channels,
+		tenant:      c.tenant,
+		health:      c.health,
+	}
+	if key, ok := c.lastKey.Load().(string); ok {
+		clone.lastKey.Store(key)
+	}
+	return clone
+}
+
+// newHTTPClient creates HTTP client based on DefaultHTTPClient with transport
+// settings from Config applied.
+func newHTTPClient(c Config) *http.Client {
+	transport := &http.Transport{MaxIdleConnsPerHost: 100}
+	if t, ok := DefaultHTTPClient.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.TLS != nil {
+		transport.TLSClientConfig = c.TLS.clientConfig()
+	}
+	if c.DialContext != nil {
+		transport.DialContext = c.DialContext
+	}
+	if c.TLS != nil && c.TLS.CAFile != "" {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		transport.DialTLSContext = c.TLS.dialTLS(dial)
+	}
+	timeout := DefaultHTTPClient.Timeout
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// unixHTTPClient lazily creates HTTP client for Unix socket addresses from
+// settings of HTTP client used for other addresses.
+type unixHTTPClient struct {
+	mu     sync.Mutex
+	base   *http.Client
+	client *http.Client
+}
+
+// get returns HTTP client for Unix socket addresses based on base, client is
+// created again when base changes.
+func (u *unixHTTPClient) get(base *http.Client) (*http.Client, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.client != nil && u.base == base {
+		return u.client, nil
+	}
+	client, err := newUnixHTTPClient(base)
+	if err != nil {
+		return nil, err
+	}
+	u.base, u.client = base, client
+	return client, nil
+}
+
+// newUnixHTTPClient creates HTTP client for Unix socket addresses with the
+// same settings as base. Socket path is passed to dialer hex-encoded in
+// request host, see unixEndpoint.
+func newUnixHTTPClient(base *http.Client) (*http.Client, error) {
+	var transport *http.Transport
+	switch t := base.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("unix socket addresses require *http.Transport, got %T", base.Transport)
+	}
+	transport.Proxy = nil
+	transport.DialTLSContext = nil
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		socket, err := hex.DecodeString(host)
+		if err != nil {
+			return nil, fmt.Errorf("malformed unix socket host %q: %w", host, err)
+		}
+		return dial(ctx, "unix", string(socket))
+	}
+	client := *base
+	client.Transport = transport
+	return &client, nil
+}
+
+// unixEndpoint converts Unix socket address to HTTP URL. HTTP path follows
+// last colon in address followed by slash, so socket paths may contain
+// colons, %3A can be used for colon followed by slash.
+func unixEndpoint(addr string) (string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	socket := u.Opaque
+	if socket == "" {
+		socket = u.Host + u.EscapedPath()
+	}
+	path := defaultUnixPath
+	if i := strings.LastIndex(socket, ":/"); i >= 0 {
+		socket, path = socket[:i], socket[i+1:]
+	}
+	socket, err = url.PathUnescape(socket)
+	if err != nil {
+		return "", err
+	}
+	if socket == "" {
+		return "", fmt.Errorf("no socket path in address %q", addr)
 	}
+	return "http://" + hex.EncodeToString([]byte(socket)) + path, nil
 }
 
 // SetHTTPClient allows to set custom http Client to use for requests. Not goroutine-safe.
@@ -81,6 +321,8 @@ func (c *Client) SetHTTPClient(httpClient *http.Client) {
 func (c *Client) Pipe() *Pipe {
 	return &Pipe{
 		commands: make([]Command, 0),
+		channels: c.channels,
+		tenant:   c.tenant,
 	}
 }
 
@@ -356,6 +598,9 @@ func (c *Client) SendPipe(ctx context.Context, pipe *Pipe) ([]Reply, error) {
 	if len(pipe.commands) == 0 {
 		return nil, ErrPipeEmpty
 	}
+	if err := c.checkTenant(pipe); err != nil {
+		return nil, err
+	}
 	result, err := c.send(ctx, pipe.commands)
 	if err != nil {
 		return nil, err
@@ -363,65 +608,286 @@ func (c *Client) SendPipe(ctx context.Context, pipe *Pipe) ([]Reply, error) {
 	if len(result) != len(pipe.commands) {
 		return nil, ErrMalformedResponse
 	}
+	if pipe.tenant != nil {
+		for i, rep := range result {
+			if result[i], err = pipe.tenant.reply(pipe.commands[i], rep); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return result, nil
 }
 
+// SendPipeStream sends Commands collected in Pipe to Centrifugo and calls fn
+// for every reply as soon as it's decoded from response, so replies are not
+// kept in memory. Sending aborted if fn returns error, this error returned
+// then. ErrMalformedResponse returned if number of replies does not match
+// number of commands, note that fn may be already called for some replies
+// in this case. Request is not retried after fn was called.
+func (c *Client) SendPipeStream(ctx context.Context, pipe *Pipe, fn func(i int, r Reply) error) error {
+	if len(pipe.commands) == 0 {
+		return ErrPipeEmpty
+	}
+	if err := c.checkTenant(pipe); err != nil {
+		return err
+	}
+	numCommands := len(pipe.commands)
+	var numReplies int
+	err := c.sendStream(ctx, pipe.commands, func(i int, rep Reply) error {
+		if i >= numCommands {
+			return ErrMalformedResponse
+		}
+		numReplies = i + 1
+		if pipe.tenant != nil {
+			var err error
+			if rep, err = pipe.tenant.reply(pipe.commands[i], rep); err != nil {
+				return err
+			}
+		}
+		return fn(i, rep)
+	}, false)
+	if err != nil {
+		return err
+	}
+	if numReplies != numCommands {
+		return ErrMalformedResponse
+	}
+	return nil
+}
+
+// checkTenant ensures tenant view sends only Pipes scoped to its tenant.
+func (c *Client) checkTenant(pipe *Pipe) error {
+	if c.tenant == nil || pipe.tenant == c.tenant {
+		return nil
+	}
+	return c.tenant.escape("", "pipe created by other client")
+}
+
 func (c *Client) send(ctx context.Context, commands []Command) ([]Reply, error) {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	var replies []Reply
+	err := c.sendStream(ctx, commands, func(i int, rep Reply) error {
+		if i == 0 {
+			// Replies of failed attempt are dropped on retry.
+			replies = make([]Reply, 0, len(commands))
+		}
+		replies = append(replies, rep)
+		return nil
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
 
-	for _, cmd := range commands {
-		err := enc.Encode(cmd)
-		if err != nil {
-			return nil, err
+// sendStream sends commands calling fn for each decoded reply. When
+// retryPartial is false request is not retried after fn was called.
+func (c *Client) sendStream(ctx context.Context, commands []Command, fn func(i int, rep Reply) error, retryPartial bool) error {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx, commands); err != nil {
+			return err
+		}
+	}
+	buf := getBuffer()
+	if err := encodeCommands(buf, commands); err != nil {
+		putBuffer(buf)
+		return err
+	}
+	body := &requestBody{tracker: bodyTracker{data: buf.b}, buffers: []*byteBuffer{buf}}
+	defer body.release()
+	if c.compressor != nil && len(buf.b) >= c.threshold {
+		compressed := getBuffer()
+		body.buffers = append(body.buffers, compressed)
+		if err := c.compressor.Compress(compressed, buf.b); err != nil {
+			return err
+		}
+		body.tracker.data, body.encoding = compressed.b, c.compressor.Encoding()
+	}
+
+	keys, err := c.credentials.APIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	keys = c.orderKeys(keys)
+
+	var called bool
+	handle := func(i int, rep Reply) error {
+		called = true
+		return fn(i, rep)
+	}
+	hedged := c.shouldHedge(commands)
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if hedged {
+			err = c.sendHedged(ctx, keys, body, handle)
+		} else {
+			var endpoint string
+			endpoint, err = c.nextEndpoint()
+			if err != nil {
+				return err
+			}
+			err = c.sendLimited(ctx, endpoint, keys, body, handle)
+		}
+		if err == nil || ctx.Err() != nil || !isRetryable(err) || (called && !retryPartial) {
+			break
+		}
+	}
+	return err
+}
+
+// sendLimited sends request respecting concurrency limit.
+func (c *Client) sendLimited(ctx context.Context, endpoint string, keys []string, body *requestBody, fn func(i int, rep Reply) error) error {
+	if c.limiter == nil {
+		return c.sendWithKeys(ctx, endpoint, keys, body, fn)
+	}
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = c.sendWithKeys(ctx, endpoint, keys, body, fn)
+	release(time.Since(start), err)
+	return err
+}
+
+// sendWithKeys sends request trying API keys in order until one is accepted.
+func (c *Client) sendWithKeys(ctx context.Context, endpoint string, keys []string, body *requestBody, fn func(i int, rep Reply) error) error {
+	if len(keys) == 0 {
+		return c.sendTo(ctx, endpoint, "", body, fn)
+	}
+	var err error
+	for _, key := range keys {
+		err = c.sendTo(ctx, endpoint, key, body, fn)
+		var statusErr ErrStatusCode
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusUnauthorized {
+			continue
+		}
+		if err == nil && len(keys) > 1 {
+			c.lastKey.Store(key)
 		}
+		break
 	}
+	return err
+}
 
-	var endpoint string
+// orderKeys moves key which was accepted last time to the front so requests
+// do not hit 401 every time during rotation window.
+func (c *Client) orderKeys(keys []string) []string {
+	lastKey, _ := c.lastKey.Load().(string)
+	if len(keys) < 2 || lastKey == "" || keys[0] == lastKey {
+		return keys
+	}
+	for i, key := range keys {
+		if key == lastKey {
+			ordered := make([]string, 0, len(keys))
+			ordered = append(ordered, key)
+			ordered = append(ordered, keys[:i]...)
+			return append(ordered, keys[i+1:]...)
+		}
+	}
+	return keys
+}
 
+// nextEndpoint returns endpoint to send request to.
+func (c *Client) nextEndpoint() (string, error) {
 	if c.getEndpoint != nil {
-		e, err := c.getEndpoint()
-		if err != nil {
-			return nil, err
+		return c.getEndpoint()
+	}
+	if len(c.endpoints) > 0 {
+		unhealthy := c.health.load()
+		for n := 1; ; n++ {
+			i := atomic.AddUint32(&c.counter, 1) - 1
+			endpoint := c.endpoints[int(i%uint32(len(c.endpoints)))]
+			// Unhealthy endpoints used only when all endpoints are unhealthy.
+			if _, skip := unhealthy[endpoint]; !skip || n >= len(c.endpoints) {
+				return endpoint, nil
+			}
 		}
-		endpoint = e
-	} else {
-		endpoint = c.endpoint
 	}
+	return c.endpoint, nil
+}
+
+// isRetryable checks whether request failed with error may be sent again.
+func isRetryable(err error) bool {
+	var statusErr ErrStatusCode
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// requestBody is encoded commands ready to be sent.
+type requestBody struct {
+	tracker bodyTracker
+	// encoding is a Content-Encoding of compressed data.
+	encoding string
+	// buffers to return to pool after request.
+	buffers []*byteBuffer
+}
+
+// release returns buffers to pool unless transport still may read from them.
+func (b *requestBody) release() {
+	if !b.tracker.released() {
+		return
+	}
+	for _, buf := range b.buffers {
+		putBuffer(buf)
+	}
+}
 
-	req, err := http.NewRequest(http.MethodPost, endpoint, &buf)
+func (c *Client) sendTo(ctx context.Context, endpoint string, apiKey string, body *requestBody, fn func(i int, rep Reply) error) error {
+	httpClient := c.httpClient
+	if strings.HasPrefix(endpoint, unixScheme) {
+		var err error
+		endpoint, err = unixEndpoint(endpoint)
+		if err != nil {
+			return err
+		}
+		httpClient, err = c.unixClient.get(httpClient)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req = req.WithContext(ctx)
+	req.Body = body.tracker.newReader()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return body.tracker.newReader(), nil
+	}
+	req.ContentLength = int64(len(body.tracker.data))
 
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "apikey "+c.apiKey)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "apikey "+apiKey)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if body.encoding != "" {
+		req.Header.Set("Content-Encoding", body.encoding)
+	}
+	if c.compressor != nil {
+		// Responses decoded in client, so transport does not handle gzip.
+		req.Header.Set("Accept-Encoding", acceptEncoding(c.compressor))
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, ErrStatusCode{resp.StatusCode}
+		return ErrStatusCode{resp.StatusCode}
 	}
 
-	var replies []Reply
-
-	dec := json.NewDecoder(resp.Body)
-	for {
-		var rep Reply
-		if err := dec.Decode(&rep); err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
+	respBody := io.Reader(resp.Body)
+	if c.compressor != nil {
+		decompressed, err := decompressBody(resp.Body, resp.Header.Get("Content-Encoding"), c.compressor)
+		if err != nil {
+			return err
 		}
-		replies = append(replies, rep)
+		defer func() { _ = decompressed.Close() }()
+		respBody = decompressed
 	}
 
-	return replies, err
+	return decodeReplies(respBody, fn)
 }
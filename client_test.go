@@ -1,6 +1,22 @@
 package gocent
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
 
 func TestNewClient(t *testing.T) {
 	c := New(Config{})
@@ -8,3 +24,211 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("New returned nil client")
 	}
 }
+
+func TestClientRetriesOverEndpoints(t *testing.T) {
+	var failed, ok int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failed, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ok, 1)
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	defer working.Close()
+
+	c := New(Config{Addrs: []string{failing.URL, working.URL}, Retries: 1})
+	for i := 0; i < 4; i++ {
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&ok) != 4 || atomic.LoadInt32(&failed) != 4 {
+		t.Fatalf("unexpected requests distribution: %d ok, %d failed", ok, failed)
+	}
+
+	c = New(Config{Addr: failing.URL})
+	_, err := c.Info(context.Background())
+	if _, isStatusErr := err.(ErrStatusCode); !isStatusErr {
+		t.Fatalf("expected ErrStatusCode, got %v", err)
+	}
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	// Not t.TempDir because socket path length is limited.
+	dir, err := os.MkdirTemp("", "gocent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	socket := filepath.Join(dir, "api:v1.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	var paths []string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	})}
+	go func() { _ = server.Serve(ln) }()
+	defer func() { _ = server.Close() }()
+
+	c := New(Config{Addr: "unix://" + socket})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c = New(Config{GetAddr: func() (string, error) {
+		return "unix://" + socket + ":/custom/api", nil
+	}})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != "/api" || paths[1] != "/custom/api" {
+		t.Fatalf("unexpected request paths: %v", paths)
+	}
+
+	// Unix socket client follows HTTP client set later.
+	var dialed []string
+	c = New(Config{Addr: "unix://" + socket})
+	c.SetHTTPClient(&http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, network+" "+addr)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialed) != 1 || dialed[0] != "unix "+socket {
+		t.Fatalf("unexpected dials: %v", dialed)
+	}
+
+	c = New(Config{Addr: "unix://" + filepath.Join(dir, "missing.sock")})
+	if _, err := c.Info(context.Background()); err == nil {
+		t.Fatal("expected error for missing socket")
+	}
+}
+
+func TestClientDialContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	defer server.Close()
+
+	var dials int32
+	c := New(Config{
+		// Address is resolved by dialer.
+		Addr: "http://centrifugo.internal/api",
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			if addr != "centrifugo.internal:80" {
+				t.Errorf("unexpected address %s", addr)
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&dials) != 1 {
+		t.Fatalf("expected custom dialer to be used, got %d dials", dials)
+	}
+	if c.unixClient.client != nil {
+		t.Fatal("unix socket client created without unix socket address")
+	}
+}
+
+func TestUnixEndpoint(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"unix:///run/api.sock":                "/run/api.sock /api",
+		"unix:///run/api.sock:/custom":        "/run/api.sock /custom",
+		"unix:///run/api:v1.sock":             "/run/api:v1.sock /api",
+		"unix:///run/api:v1.sock:/custom/api": "/run/api:v1.sock /custom/api",
+		"unix:///run/api%3A/v1.sock:/custom":  "/run/api:/v1.sock /custom",
+	} {
+		endpoint, err := unixEndpoint(addr)
+		if err != nil {
+			t.Fatalf("%s: %v", addr, err)
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		socket, _ := hex.DecodeString(u.Host)
+		if got := string(socket) + " " + u.Path; got != expected {
+			t.Fatalf("%s: expected %q, got %q", addr, expected, got)
+		}
+	}
+	if _, err := unixEndpoint("unix://"); err == nil {
+		t.Fatal("expected error for empty socket path")
+	}
+}
+
+func TestClientSendPipeStream(t *testing.T) {
+	// Server replies with offset equal to reply index, numReplies overrides
+	// number of replies.
+	var numReplies int32 = -1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := bytes.Count(body, []byte("\n"))
+		if override := atomic.LoadInt32(&numReplies); override >= 0 {
+			n = int(override)
+		}
+		for i := 0; i < n; i++ {
+			_, _ = fmt.Fprintf(w, `{"result":{"offset":%d}}`+"\n", i)
+		}
+	}))
+	defer server.Close()
+	c := New(Config{Addr: server.URL})
+
+	pipe := c.Pipe()
+	for i := 0; i < 1000; i++ {
+		_ = pipe.AddPublish("chat", []byte(`{}`))
+	}
+	var count int
+	err := c.SendPipeStream(context.Background(), pipe, func(i int, r Reply) error {
+		var result PublishResult
+		if err := json.Unmarshal(r.Result, &result); err != nil {
+			return err
+		}
+		if int(result.Offset) != i {
+			t.Fatalf("unexpected reply %d for command %d", result.Offset, i)
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 1000 {
+		t.Fatalf("unexpected result: %d replies, error %v", count, err)
+	}
+
+	errStop := errors.New("stop")
+	count = 0
+	err = c.SendPipeStream(context.Background(), pipe, func(i int, r Reply) error {
+		count++
+		if i == 9 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || count != 10 {
+		t.Fatalf("expected abort after 10 replies, got %d replies, error %v", count, err)
+	}
+
+	for _, n := range []int32{999, 1001} {
+		atomic.StoreInt32(&numReplies, n)
+		count = 0
+		err = c.SendPipeStream(context.Background(), pipe, func(int, Reply) error {
+			count++
+			return nil
+		})
+		if err != ErrMalformedResponse || count > 1000 {
+			t.Fatalf("%d replies: expected ErrMalformedResponse, got %v after %d replies", n, err, count)
+		}
+	}
+
+	if err := c.SendPipeStream(context.Background(), c.Pipe(), nil); err != ErrPipeEmpty {
+		t.Fatalf("expected ErrPipeEmpty, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package gocent
+
+import (
+	"sort"
+)
+
+// ClusterSummary contains aggregated statistics of Centrifugo nodes.
+type ClusterSummary struct {
+	// NumNodes is a number of running nodes.
+	NumNodes int
+	// NumClients is a total number of clients connected to nodes.
+	NumClients int
+	// NumUsers is a sum of unique users of every node, user connected to
+	// several nodes counted several times.
+	NumUsers int
+	// NumChannels is a sum of channels of every node, channel existing on
+	// several nodes counted several times.
+	NumChannels int
+	// RSS is a total resident set size of node processes in bytes.
+	RSS int64
+	// MaxCPU is a maximum CPU usage of node process in percents.
+	MaxCPU float64
+	// Versions contains number of nodes per Centrifugo version.
+	Versions map[string]int
+	// VersionSkew is true when nodes run different Centrifugo versions.
+	VersionSkew bool
+	// NodesWithoutMetrics contains UIDs of nodes which reported no metrics.
+	NodesWithoutMetrics []string
+}
+
+// Summary aggregates statistics of nodes in InfoResult. Info reply contains
+// no time metrics were collected at, so only nodes without metrics flagged.
+func (r InfoResult) Summary() ClusterSummary {
+	summary := ClusterSummary{
+		NumNodes: len(r.Nodes),
+		Versions: make(map[string]int),
+	}
+	for _, node := range r.Nodes {
+		summary.NumClients += node.NumClients
+		summary.NumUsers += node.NumUsers
+		summary.NumChannels += node.NumChannels
+		summary.Versions[node.Version]++
+		if node.Process != nil {
+			summary.RSS += node.Process.RSS
+			if node.Process.CPU > summary.MaxCPU {
+				summary.MaxCPU = node.Process.CPU
+			}
+		}
+		if node.Metrics == nil || len(node.Metrics.Items) == 0 {
+			summary.NodesWithoutMetrics = append(summary.NodesWithoutMetrics, node.UID)
+		}
+	}
+	summary.VersionSkew = len(summary.Versions) > 1
+	sort.Strings(summary.NodesWithoutMetrics)
+	return summary
+}
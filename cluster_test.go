@@ -0,0 +1,42 @@
+package gocent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInfoResultSummary(t *testing.T) {
+	info, err := decodeInfo([]byte(`{"nodes":[
+		{"uid":"1","name":"a","version":"3.1.0","num_clients":10,"num_users":5,"num_channels":3,"uptime":100,
+		 "metrics":{"interval":60,"items":{"centrifugo.node.num_clients":10}},"process":{"cpu":12.5,"rss":1000}},
+		{"uid":"2","name":"b","version":"3.1.1","num_clients":4,"num_users":2,"num_channels":1,"uptime":10,
+		 "process":{"cpu":30,"rss":500}},
+		{"uid":"3","name":"c","version":"3.1.0","num_clients":1,"num_users":1,"num_channels":1,"uptime":1000,
+		 "metrics":{"interval":300,"items":{"centrifugo.node.num_clients":1}}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := info.Nodes[0].Metrics; m == nil || m.Interval != 60 || m.Items["centrifugo.node.num_clients"] != 10 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+	if p := info.Nodes[0].Process; p == nil || p.CPU != 12.5 || p.RSS != 1000 {
+		t.Fatalf("unexpected process %+v", p)
+	}
+
+	summary := info.Summary()
+	expected := ClusterSummary{
+		NumNodes:            3,
+		NumClients:          15,
+		NumUsers:            8,
+		NumChannels:         5,
+		RSS:                 1500,
+		MaxCPU:              30,
+		Versions:            map[string]int{"3.1.0": 2, "3.1.1": 1},
+		VersionSkew:         true,
+		NodesWithoutMetrics: []string{"2"},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, summary)
+	}
+}
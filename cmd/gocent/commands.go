@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+func init() {
+	commands["publish"] = command{
+		usage: "[--data JSON | --file PATH] [--skip-history] [--idempotency-key KEY] <channel>",
+		help:  "publish data into channel",
+		run:   runPublish,
+	}
+	commands["broadcast"] = command{
+		usage: "[--data JSON | --file PATH] [--skip-history] [--idempotency-key KEY] <channel>...",
+		help:  "publish the same data into many channels",
+		run:   runBroadcast,
+	}
+	commands["subscribe"] = command{
+		usage: "[--client ID] <channel> <user>",
+		help:  "subscribe user to channel using server-side subscription",
+		run:   runSubscribe,
+	}
+	commands["unsubscribe"] = command{
+		usage: "[--client ID] <channel> <user>",
+		help:  "unsubscribe user from channel",
+		run:   runUnsubscribe,
+	}
+	commands["disconnect"] = command{
+		usage: "[--client ID] <user>",
+		help:  "disconnect user connections",
+		run:   runDisconnect,
+	}
+	commands["presence"] = command{
+		usage: "[--watch [--interval DURATION]] <channel>",
+		help:  "show channel presence or watch join/leave events",
+		run:   runPresence,
+	}
+	commands["presence-stats"] = command{
+		usage: "<channel>",
+		help:  "show channel presence counters",
+		run:   runPresenceStats,
+	}
+	commands["history"] = command{
+		usage: "[--limit N] [--reverse] [--since-offset N --since-epoch EPOCH] <channel>",
+		help:  "show channel history",
+		run:   runHistory,
+	}
+	commands["history-remove"] = command{
+		usage: "<channel>",
+		help:  "remove channel history",
+		run:   runHistoryRemove,
+	}
+	commands["channels"] = command{
+		usage: "[--pattern PATTERN]",
+		help:  "show active channels",
+		run:   runChannels,
+	}
+	commands["info"] = command{
+		usage: "",
+		help:  "show information about server nodes",
+		run:   runInfo,
+	}
+}
+
+// flagSetWithData is a FlagSet of commands which publish data.
+type flagSetWithData struct {
+	*flag.FlagSet
+	data           string
+	file           string
+	skipHistory    bool
+	idempotencyKey string
+}
+
+// dataFlags creates FlagSet with flags to read publication data.
+func dataFlags(c *cli, name string) *flagSetWithData {
+	f := &flagSetWithData{FlagSet: c.newFlagSet(name)}
+	f.StringVar(&f.data, "data", "", "JSON data, by default read from stdin")
+	f.StringVar(&f.file, "file", "", "path to file with JSON data, - for stdin")
+	f.BoolVar(&f.skipHistory, "skip-history", false, "do not save publication to history")
+	f.StringVar(&f.idempotencyKey, "idempotency-key", "", "idempotency key of publication")
+	return f
+}
+
+func readData(c *cli, f *flagSetWithData) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case f.data != "":
+		data = []byte(f.data)
+	case f.file != "" && f.file != "-":
+		data, err = os.ReadFile(f.file)
+	default:
+		data, err = io.ReadAll(c.stdin)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("data is not a valid JSON")
+	}
+	return data, nil
+}
+
+func (f *flagSetWithData) publishOptions() []gocent.PublishOption {
+	var opts []gocent.PublishOption
+	if f.skipHistory {
+		opts = append(opts, gocent.WithSkipHistory(true))
+	}
+	if f.idempotencyKey != "" {
+		opts = append(opts, gocent.WithIdempotencyKey(f.idempotencyKey))
+	}
+	return opts
+}
+
+func runPublish(ctx context.Context, c *cli, args []string) error {
+	fs := dataFlags(c, "publish")
+	args, err := parseFlags(fs.FlagSet, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	data, err := readData(c, fs)
+	if err != nil {
+		return err
+	}
+	result, err := c.client.Publish(ctx, args[0], data, fs.publishOptions()...)
+	if err != nil {
+		return err
+	}
+	return c.print(output{
+		value:  result,
+		header: []string{"OFFSET", "EPOCH"},
+		rows:   [][]string{{strconv.FormatUint(result.Offset, 10), result.Epoch}},
+	})
+}
+
+func runBroadcast(ctx context.Context, c *cli, args []string) error {
+	fs := dataFlags(c, "broadcast")
+	args, err := parseFlags(fs.FlagSet, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errUsage
+	}
+	data, err := readData(c, fs)
+	if err != nil {
+		return err
+	}
+	result, err := c.client.Broadcast(ctx, args, data, fs.publishOptions()...)
+	if err != nil {
+		return err
+	}
+	out := output{value: result, items: []interface{}{}, header: []string{"CHANNEL", "OFFSET", "EPOCH", "ERROR"}}
+	var failed int
+	for i, resp := range result.Responses {
+		out.items = append(out.items, resp)
+		row := []string{"", "", "", ""}
+		if i < len(args) {
+			row[0] = args[i]
+		}
+		if resp.Result != nil {
+			row[1] = strconv.FormatUint(resp.Result.Offset, 10)
+			row[2] = resp.Result.Epoch
+		}
+		if resp.Error != nil {
+			failed++
+			row[3] = resp.Error.Error()
+		}
+		out.rows = append(out.rows, row)
+	}
+	if err := c.print(out); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("broadcast failed for %d channels", failed)
+	}
+	return nil
+}
+
+func runSubscribe(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("subscribe")
+	client := fs.String("client", "", "subscribe only connection with this client ID")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+	return c.client.Subscribe(ctx, args[0], args[1], gocent.WithSubscribeClient(*client))
+}
+
+func runUnsubscribe(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("unsubscribe")
+	client := fs.String("client", "", "unsubscribe only connection with this client ID")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+	return c.client.Unsubscribe(ctx, args[0], args[1], gocent.WithUnsubscribeClient(*client))
+}
+
+func runDisconnect(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("disconnect")
+	client := fs.String("client", "", "disconnect only connection with this client ID")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	return c.client.Disconnect(ctx, args[0], gocent.WithDisconnectClient(*client))
+}
+
+func runPresence(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("presence")
+	watch := fs.Bool("watch", false, "watch presence and print join/leave events until interrupted")
+	interval := fs.Duration("interval", time.Second, "presence poll interval in watch mode")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	if *watch {
+		return watchPresence(ctx, c, args[0], *interval)
+	}
+	result, err := c.client.Presence(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	out := output{value: result, items: []interface{}{}, header: []string{"CLIENT", "USER", "CONN_INFO", "CHAN_INFO"}}
+	for _, id := range sortedClientIDs(result.Presence) {
+		info := result.Presence[id]
+		out.items = append(out.items, info)
+		out.rows = append(out.rows, []string{info.Client, info.User, string(info.ConnInfo), string(info.ChanInfo)})
+	}
+	return c.print(out)
+}
+
+func runPresenceStats(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("presence-stats")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	result, err := c.client.PresenceStats(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(output{
+		value:  result,
+		header: []string{"NUM_CLIENTS", "NUM_USERS"},
+		rows:   [][]string{{strconv.Itoa(int(result.NumClients)), strconv.Itoa(int(result.NumUsers))}},
+	})
+}
+
+func runHistory(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("history")
+	limit := fs.Int("limit", gocent.NoLimit, "maximum number of publications, -1 means all")
+	reverse := fs.Bool("reverse", false, "iterate from newest publications")
+	sinceOffset := fs.Uint64("since-offset", 0, "return publications after this offset")
+	sinceEpoch := fs.String("since-epoch", "", "epoch of since position")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	opts := []gocent.HistoryOption{gocent.WithLimit(*limit), gocent.WithReverse(*reverse)}
+	if *sinceOffset > 0 || *sinceEpoch != "" {
+		opts = append(opts, gocent.WithSince(&gocent.StreamPosition{Offset: *sinceOffset, Epoch: *sinceEpoch}))
+	}
+	result, err := c.client.History(ctx, args[0], opts...)
+	if err != nil {
+		return err
+	}
+	out := output{value: result, items: []interface{}{}, header: publicationHeader}
+	for _, pub := range result.Publications {
+		out.items = append(out.items, pub)
+		out.rows = append(out.rows, publicationRow(pub))
+	}
+	return c.print(out)
+}
+
+var publicationHeader = []string{"OFFSET", "USER", "CLIENT", "DATA"}
+
+func publicationRow(pub gocent.Publication) []string {
+	row := []string{strconv.FormatUint(pub.Offset, 10), "", "", string(pub.Data)}
+	if pub.Info != nil {
+		row[1] = pub.Info.User
+		row[2] = pub.Info.Client
+	}
+	return row
+}
+
+func runHistoryRemove(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("history-remove")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	return c.client.HistoryRemove(ctx, args[0])
+}
+
+func runChannels(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("channels")
+	pattern := fs.String("pattern", "", "filter channels by pattern")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return errUsage
+	}
+	result, err := c.client.Channels(ctx, gocent.WithPattern(*pattern))
+	if err != nil {
+		return err
+	}
+	out := output{value: result, items: []interface{}{}, header: []string{"CHANNEL", "NUM_USERS"}}
+	for _, ch := range sortedChannels(result.Channels) {
+		info := result.Channels[ch]
+		out.items = append(out.items, struct {
+			Channel  string `json:"channel"`
+			NumUsers int32  `json:"num_users"`
+		}{ch, info.NumUsers})
+		out.rows = append(out.rows, []string{ch, strconv.Itoa(int(info.NumUsers))})
+	}
+	return c.print(out)
+}
+
+func runInfo(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("info")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return errUsage
+	}
+	result, err := c.client.Info(ctx)
+	if err != nil {
+		return err
+	}
+	out := output{value: result, items: []interface{}{}, header: []string{"NAME", "UID", "VERSION", "CLIENTS", "USERS", "CHANNELS", "UPTIME"}}
+	for _, node := range result.Nodes {
+		out.items = append(out.items, node)
+		out.rows = append(out.rows, []string{
+			node.Name, node.UID, node.Version,
+			strconv.Itoa(node.NumClients), strconv.Itoa(node.NumUsers), strconv.Itoa(node.NumChannels),
+			strconv.Itoa(node.Uptime),
+		})
+	}
+	return c.print(out)
+}
+
+// runPipe reads commands in Centrifugo API JSON format, one per line, and
+// sends them in one request.
+func runPipe(ctx context.Context, c *cli, args []string) error {
+	var r io.Reader = c.stdin
+	if len(args) > 1 {
+		return errors.New("pipe mode accepts at most one file argument")
+	}
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	pipe := c.client.Pipe()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var cmd struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if cmd.Method == "" {
+			return fmt.Errorf("line %d: method required", line)
+		}
+		if len(cmd.Params) == 0 {
+			cmd.Params = json.RawMessage(`{}`)
+		}
+		_ = pipe.AddCommand(gocent.Command{Method: cmd.Method, Params: cmd.Params})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	replies, err := c.client.SendPipe(ctx, pipe)
+	if err != nil {
+		return err
+	}
+	out := output{value: replies, items: []interface{}{}, header: []string{"INDEX", "ERROR", "RESULT"}}
+	var failed int
+	for i, reply := range replies {
+		out.items = append(out.items, reply)
+		var replyErr string
+		if reply.Error != nil {
+			failed++
+			replyErr = reply.Error.Error()
+		}
+		out.rows = append(out.rows, []string{strconv.Itoa(i), replyErr, string(reply.Result)})
+	}
+	if err := c.print(out); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, len(replies))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Command gocent is a command-line tool to call Centrifugo server HTTP API.
+//
+// Usage:
+//
+//	gocent [flags] <command> [command flags] [arguments]
+//
+// Run gocent -h to see available commands and flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage returned by commands when arguments are invalid.
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = map[string]command{}
+
+// cli keeps state shared by all commands.
+type cli struct {
+	client *gocent.Client
+	format string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	cancel()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg, err := gocent.ConfigFromEnv("GOCENT")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%v\n", err)
+		return exitUsage
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = "http://localhost:8000/api"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	fs := flag.NewFlagSet("gocent", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dsn := fs.String("dsn", "", "Centrifugo DSN like centrifugo+https://key@host:8000/api?timeout=2s, env GOCENT_DSN")
+	addr := fs.String("addr", cfg.Addr, "Centrifugo API endpoint, env GOCENT_ADDR")
+	key := fs.String("key", cfg.Key, "Centrifugo API key, env GOCENT_KEY or GOCENT_KEY_FILE")
+	timeout := fs.Duration("timeout", cfg.Timeout, "request timeout, env GOCENT_TIMEOUT")
+	format := fs.String("format", envOr("GOCENT_FORMAT", formatJSON), "output format: json, table or jsonl, env GOCENT_FORMAT")
+	pipe := fs.Bool("pipe", false, "read commands as JSONL from stdin (or file argument) and send them in one request")
+	fs.Usage = func() { printUsage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		_, _ = fmt.Fprintf(stderr, "unknown output format %q\n", *format)
+		return exitUsage
+	}
+	if *dsn != "" {
+		dsnConfig, err := gocent.ParseDSN(*dsn)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%v\n", err)
+			return exitUsage
+		}
+		if dsnConfig.Timeout == 0 {
+			dsnConfig.Timeout = cfg.Timeout
+		}
+		cfg = dsnConfig
+	}
+	// Explicitly set flags override environment and DSN.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr, cfg.Addrs = *addr, nil
+		case "key":
+			cfg.Key = *key
+		case "timeout":
+			cfg.Timeout = *timeout
+		}
+	})
+
+	c := &cli{
+		client: gocent.New(cfg),
+		format: *format,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	var cmdName string
+	if *pipe {
+		cmdName = "pipe"
+		err = runPipe(ctx, c, fs.Args())
+	} else {
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return exitUsage
+		}
+		cmdName = fs.Arg(0)
+		cmd, ok := commands[cmdName]
+		if !ok {
+			_, _ = fmt.Fprintf(stderr, "unknown command %q\n", cmdName)
+			fs.Usage()
+			return exitUsage
+		}
+		err = cmd.run(ctx, c, fs.Args()[1:])
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		if errors.Is(err, errUsage) {
+			if cmd, ok := commands[cmdName]; ok {
+				_, _ = fmt.Fprintf(stderr, "usage: gocent %s %s\n", cmdName, cmd.usage)
+			}
+			return exitUsage
+		}
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	_, _ = fmt.Fprintf(out, "Usage: gocent [flags] <command> [command flags] [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(out, "  %-16s %s\n", name, commands[name].help)
+	}
+	_, _ = fmt.Fprintf(out, "\nFlags:\n")
+	fs.PrintDefaults()
+}
+
+// newFlagSet creates FlagSet for command which writes usage to stderr.
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(c.stderr, "usage: gocent %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses command flags allowing them to be placed after positional
+// arguments, i.e. both "publish --data {} chat" and "publish chat --data {}" work.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
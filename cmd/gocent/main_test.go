@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer returns server which replies to every command with result
+// returned by handler.
+func newTestServer(t *testing.T, handler func(method string, params json.RawMessage) (interface{}, *replyError)) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scanner := bufio.NewScanner(r.Body)
+		enc := json.NewEncoder(w)
+		for scanner.Scan() {
+			var cmd struct {
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}
+			_ = json.Unmarshal(scanner.Bytes(), &cmd)
+			result, replyErr := handler(cmd.Method, cmd.Params)
+			if replyErr != nil {
+				_ = enc.Encode(map[string]interface{}{"error": replyErr})
+				continue
+			}
+			_ = enc.Encode(map[string]interface{}{"result": result})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+type replyError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func runCLI(args []string, stdin string) (int, string, string) {
+	return runCLIContext(context.Background(), args, stdin)
+}
+
+func runCLIContext(ctx context.Context, args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestPublish(t *testing.T) {
+	var published string
+	ts := newTestServer(t, func(method string, params json.RawMessage) (interface{}, *replyError) {
+		published = string(params)
+		return map[string]interface{}{"offset": 5, "epoch": "xyz"}, nil
+	})
+	code, stdout, stderr := runCLI([]string{"--addr", ts.URL, "--format", "table", "publish", "chat", "--skip-history"}, `{"input":1}`)
+	if code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr)
+	}
+	if published != `{"channel":"chat","data":{"input":1},"skip_history":true}` {
+		t.Fatalf("unexpected params: %s", published)
+	}
+	if !strings.Contains(stdout, "OFFSET") || !strings.Contains(stdout, "xyz") {
+		t.Fatalf("unexpected output: %s", stdout)
+	}
+}
+
+func TestReplyError(t *testing.T) {
+	ts := newTestServer(t, func(method string, params json.RawMessage) (interface{}, *replyError) {
+		return nil, &replyError{Code: 102, Message: "unknown channel"}
+	})
+	code, _, stderr := runCLI([]string{"--addr", ts.URL, "presence", "chat"}, "")
+	if code != exitError || !strings.Contains(stderr, "unknown channel") {
+		t.Fatalf("unexpected result: %d, %s", code, stderr)
+	}
+	code, _, _ = runCLI([]string{"--addr", ts.URL, "presence"}, "")
+	if code != exitUsage {
+		t.Fatalf("expected usage exit code, got %d", code)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	var methods []string
+	ts := newTestServer(t, func(method string, params json.RawMessage) (interface{}, *replyError) {
+		methods = append(methods, method)
+		if method == "history" {
+			return nil, &replyError{Code: 108, Message: "not available"}
+		}
+		return map[string]interface{}{}, nil
+	})
+	stdin := `{"method":"publish","params":{"channel":"a","data":{}}}` + "\n" + `{"method":"history","params":{"channel":"a"}}` + "\n"
+	code, stdout, _ := runCLI([]string{"--addr", ts.URL, "--format", "jsonl", "--pipe"}, stdin)
+	if code != exitError {
+		t.Fatalf("expected error exit code, got %d", code)
+	}
+	if strings.Join(methods, ",") != "publish,history" {
+		t.Fatalf("unexpected methods: %v", methods)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 2 {
+		t.Fatalf("expected 2 reply lines, got: %s", stdout)
+	}
+}
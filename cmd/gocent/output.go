@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+	formatJSONL = "jsonl"
+)
+
+func validFormat(format string) bool {
+	switch format {
+	case formatJSON, formatTable, formatJSONL:
+		return true
+	default:
+		return false
+	}
+}
+
+// output describes command result in all supported formats.
+type output struct {
+	// value printed as pretty JSON.
+	value interface{}
+	// items printed one per line in JSONL format. If empty value printed.
+	items []interface{}
+	// header and rows printed in table format.
+	header []string
+	rows   [][]string
+}
+
+func (c *cli) print(out output) error {
+	switch c.format {
+	case formatTable:
+		w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		if _, err := w.Write([]byte(strings.Join(out.header, "\t") + "\n")); err != nil {
+			return err
+		}
+		for _, row := range out.rows {
+			if _, err := w.Write([]byte(strings.Join(row, "\t") + "\n")); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	case formatJSONL:
+		enc := json.NewEncoder(c.stdout)
+		if out.items == nil {
+			return enc.Encode(out.value)
+		}
+		for _, item := range out.items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out.value)
+	}
+}
+
+func sortedClientIDs(presence map[string]gocent.ClientInfo) []string {
+	ids := make([]string, 0, len(presence))
+	for id := range presence {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedChannels(channels map[string]gocent.ChannelInfo) []string {
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
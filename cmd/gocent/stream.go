@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+func init() {
+	commands["tail"] = command{
+		usage: "[--since-offset N --since-epoch EPOCH] [--interval DURATION] [--max-interval DURATION] <channel>",
+		help:  "follow channel history and print new publications until interrupted",
+		run:   runTail,
+	}
+}
+
+// printEvent prints one event of a stream: JSON value for json and jsonl
+// formats, space separated row for table format.
+func (c *cli) printEvent(value interface{}, row []string) error {
+	switch c.format {
+	case formatTable:
+		_, err := fmt.Fprintln(c.stdout, strings.Join(row, "  "))
+		return err
+	case formatJSONL:
+		return json.NewEncoder(c.stdout).Encode(value)
+	default:
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	}
+}
+
+func (c *cli) notice(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(c.stderr, format+"\n", args...)
+}
+
+type tailPublication struct {
+	Offset uint64             `json:"offset"`
+	Epoch  string             `json:"epoch"`
+	Data   json.RawMessage    `json:"data"`
+	Info   *gocent.ClientInfo `json:"info,omitempty"`
+}
+
+func runTail(ctx context.Context, c *cli, args []string) error {
+	fs := c.newFlagSet("tail")
+	sinceOffset := fs.Uint64("since-offset", 0, "print publications after this offset, by default only new publications printed")
+	sinceEpoch := fs.String("since-epoch", "", "epoch of since position")
+	interval := fs.Duration("interval", 200*time.Millisecond, "history poll interval")
+	maxInterval := fs.Duration("max-interval", 2*time.Second, "maximum poll interval when channel is idle")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+	opts := []gocent.TailOption{gocent.WithTailInterval(*interval, *maxInterval)}
+	if *sinceOffset > 0 || *sinceEpoch != "" {
+		opts = append(opts, gocent.WithTailSince(&gocent.StreamPosition{Offset: *sinceOffset, Epoch: *sinceEpoch}))
+	}
+	events, err := c.client.Tail(ctx, args[0], opts...)
+	if err != nil {
+		return err
+	}
+	if c.format == formatTable {
+		_, _ = fmt.Fprintln(c.stdout, strings.Join(publicationHeader, "  "))
+	}
+	for event := range events {
+		switch event.Type {
+		case gocent.TailPublication:
+			pub := event.Publication
+			err = c.printEvent(tailPublication{
+				Offset: pub.Offset,
+				Epoch:  event.Position.Epoch,
+				Data:   pub.Data,
+				Info:   pub.Info,
+			}, publicationRow(pub))
+			if err != nil {
+				return err
+			}
+		case gocent.TailGap:
+			c.notice("publications lost: offsets %d-%d", event.MissedFrom, event.MissedTo)
+		case gocent.TailEpochReset:
+			c.notice("stream epoch changed to %q, following new stream", event.Position.Epoch)
+		case gocent.TailError:
+			c.notice("error: %v", event.Err)
+		}
+	}
+	return nil
+}
+
+type presenceEvent struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	gocent.ClientInfo
+}
+
+func watchPresence(ctx context.Context, c *cli, channel string, interval time.Duration) error {
+	w := gocent.NewPresenceWatcher(c.client, gocent.PresenceWatcherConfig{
+		Interval:     interval,
+		InitialJoins: true,
+	})
+	w.Add(channel)
+	go func() { _ = w.Run(ctx) }()
+	if c.format == formatTable {
+		_, _ = fmt.Fprintln(c.stdout, "EVENT  CLIENT  USER  CONN_INFO")
+	}
+	for event := range w.Events() {
+		var typ string
+		switch event.Type {
+		case gocent.PresenceJoin:
+			typ = "join"
+		case gocent.PresenceLeave:
+			typ = "leave"
+		default:
+			c.notice("error: %v", event.Err)
+			continue
+		}
+		row := []string{strings.ToUpper(typ), event.Info.Client, strconv.Quote(event.Info.User), string(event.Info.ConnInfo)}
+		if err := c.printEvent(presenceEvent{Type: typ, Channel: event.Channel, ClientInfo: event.Info}, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	var mu sync.Mutex
+	var top uint64
+	ts := newTestServer(t, func(method string, params json.RawMessage) (interface{}, *replyError) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req struct {
+			Since *struct {
+				Offset uint64 `json:"offset"`
+			} `json:"since"`
+		}
+		_ = json.Unmarshal(params, &req)
+		// Every poll one more publication appears in channel.
+		top++
+		var pubs []interface{}
+		if req.Since != nil {
+			for o := req.Since.Offset + 1; o <= top; o++ {
+				pubs = append(pubs, map[string]interface{}{"offset": o, "data": map[string]interface{}{"n": o}, "info": map[string]string{"user": "u", "client": "c"}})
+			}
+		}
+		return map[string]interface{}{"publications": pubs, "offset": top, "epoch": "e"}, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	code, stdout, stderr := runCLIContext(ctx, []string{"--addr", ts.URL, "--format", "jsonl", "tail", "--interval", "10ms", "--since-epoch", "e", "chat"}, "")
+	if code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected several publications, got: %s", stdout)
+	}
+	for i, line := range lines {
+		var pub tailPublication
+		if err := json.Unmarshal([]byte(line), &pub); err != nil {
+			t.Fatal(err)
+		}
+		if pub.Offset != uint64(i+1) || pub.Info == nil || pub.Info.User != "u" {
+			t.Fatalf("unexpected publication: %s", line)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	commands["token"] = command{
+		usage: "connect|subscribe|decode [flags]",
+		help:  "generate or decode connection and subscription JWT",
+		run:   runToken,
+	}
+}
+
+func runToken(_ context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "connect":
+		return runTokenGenerate(c, "token connect", args[1:], false)
+	case "subscribe":
+		return runTokenGenerate(c, "token subscribe", args[1:], true)
+	case "decode":
+		return runTokenDecode(c, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+// tokenClaims contains claims of Centrifugo connection and subscription tokens.
+type tokenClaims struct {
+	Sub      string          `json:"sub"`
+	Channel  string          `json:"channel,omitempty"`
+	Exp      int64           `json:"exp,omitempty"`
+	Iat      int64           `json:"iat,omitempty"`
+	Info     json.RawMessage `json:"info,omitempty"`
+	Channels []string        `json:"channels,omitempty"`
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// keyFlags adds flags to provide a key for signing or verifying tokens.
+func keyFlags(fs *flag.FlagSet, secret, keyFile *string) {
+	fs.StringVar(secret, "secret", os.Getenv("GOCENT_TOKEN_SECRET"), "HMAC secret, env GOCENT_TOKEN_SECRET")
+	fs.StringVar(keyFile, "key-file", "", "path to PEM encoded RSA or ECDSA key")
+}
+
+func runTokenGenerate(c *cli, name string, args []string, subscribe bool) error {
+	fs := c.newFlagSet("token")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(c.stderr, "usage: gocent %s [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	var secret, keyFile string
+	keyFlags(fs, &secret, &keyFile)
+	user := fs.String("user", "", "user ID, empty for anonymous")
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime, 0 means token never expires")
+	info := fs.String("info", "", "JSON info attached to connection or subscription")
+	var channel string
+	var channels stringList
+	if subscribe {
+		fs.StringVar(&channel, "channel", "", "channel to subscribe")
+	} else {
+		fs.Var(&channels, "channels", "comma-separated channels to subscribe on connect, may be repeated")
+	}
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 || (subscribe && channel == "") {
+		return errUsage
+	}
+	key, err := loadKey(secret, keyFile, true)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	claims := tokenClaims{Sub: *user, Channel: channel, Iat: now.Unix(), Channels: channels}
+	if *ttl > 0 {
+		claims.Exp = now.Add(*ttl).Unix()
+	}
+	if *info != "" {
+		if !json.Valid([]byte(*info)) {
+			return errors.New("info is not a valid JSON")
+		}
+		claims.Info = json.RawMessage(*info)
+	}
+	token, err := signToken(claims, key)
+	if err != nil {
+		return err
+	}
+	return c.print(output{
+		value:  map[string]string{"token": token},
+		header: []string{"TOKEN"},
+		rows:   [][]string{{token}},
+	})
+}
+
+func runTokenDecode(c *cli, args []string) error {
+	fs := c.newFlagSet("token")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(c.stderr, "usage: gocent token decode [flags] <token>\n")
+		fs.PrintDefaults()
+	}
+	var secret, keyFile string
+	keyFlags(fs, &secret, &keyFile)
+	noVerify := fs.Bool("no-verify", false, "do not verify signature and expiration")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+	header, claims, verifyErr := decodeToken(rest[0])
+	if verifyErr == nil && !*noVerify {
+		key, err := loadKey(secret, keyFile, false)
+		if err != nil {
+			return err
+		}
+		verifyErr = verifyToken(rest[0], header, claims, key, time.Now())
+	}
+	if header == nil {
+		return verifyErr
+	}
+	result := struct {
+		Header    map[string]interface{} `json:"header"`
+		Claims    map[string]interface{} `json:"claims"`
+		Verified  bool                   `json:"verified"`
+		ExpiresAt string                 `json:"expires_at,omitempty"`
+	}{Header: header, Claims: claims, Verified: !*noVerify && verifyErr == nil}
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = time.Unix(int64(exp), 0).UTC().Format(time.RFC3339)
+	}
+	out := output{value: result, header: []string{"CLAIM", "VALUE"}}
+	for _, name := range sortedClaimNames(claims) {
+		value, _ := json.Marshal(claims[name])
+		out.rows = append(out.rows, []string{name, string(value)})
+	}
+	if err := c.print(out); err != nil {
+		return err
+	}
+	if verifyErr != nil && !*noVerify {
+		return verifyErr
+	}
+	return nil
+}
+
+func sortedClaimNames(claims map[string]interface{}) []string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadKey returns HMAC secret as []byte or parsed PEM key. Private keys
+// required for signing, public keys and certificates accepted for verifying.
+func loadKey(secret, keyFile string, private bool) (interface{}, error) {
+	if keyFile == "" {
+		if secret == "" {
+			return nil, errors.New("either --secret or --key-file required")
+		}
+		return []byte(secret), nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found in key file")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return publicIfNeeded(key, private)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return publicIfNeeded(key, private)
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return publicIfNeeded(key, private)
+	}
+	if private {
+		return nil, errors.New("private key required to sign token")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported key type in PEM block %q", block.Type)
+}
+
+func publicIfNeeded(key interface{}, private bool) (interface{}, error) {
+	if private {
+		return key, nil
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// algorithm returns JWS algorithm name and hash for a key.
+func algorithm(key interface{}) (string, crypto.Hash, error) {
+	switch k := key.(type) {
+	case []byte:
+		return "HS256", crypto.SHA256, nil
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return "RS256", crypto.SHA256, nil
+	case *ecdsa.PrivateKey:
+		return ecdsaAlgorithm(k.Curve.Params().BitSize)
+	case *ecdsa.PublicKey:
+		return ecdsaAlgorithm(k.Curve.Params().BitSize)
+	default:
+		return "", 0, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func ecdsaAlgorithm(bitSize int) (string, crypto.Hash, error) {
+	switch bitSize {
+	case 256:
+		return "ES256", crypto.SHA256, nil
+	case 384:
+		return "ES384", crypto.SHA384, nil
+	case 521:
+		return "ES512", crypto.SHA512, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported ECDSA curve size %d", bitSize)
+	}
+}
+
+func newHash(h crypto.Hash) hash.Hash {
+	switch h {
+	case crypto.SHA384:
+		return sha512.New384()
+	case crypto.SHA512:
+		return sha512.New()
+	default:
+		return sha256.New()
+	}
+}
+
+var b64 = base64.RawURLEncoding
+
+func signToken(claims tokenClaims, key interface{}) (string, error) {
+	alg, h, err := algorithm(key)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		_, _ = mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := newHash(h)
+		_, _ = digest.Write([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, h, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		digest := newHash(h)
+		_, _ = digest.Write([]byte(signingInput))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		if err == nil {
+			size := (k.Curve.Params().BitSize + 7) / 8
+			signature = make([]byte, 2*size)
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+		}
+	default:
+		return "", fmt.Errorf("unsupported signing key type %T", key)
+	}
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64.EncodeToString(signature), nil
+}
+
+// decodeToken decodes token header and claims without verification.
+func decodeToken(token string) (map[string]interface{}, map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("malformed token: expected 3 parts")
+	}
+	var header, claims map[string]interface{}
+	for i, dst := range []*map[string]interface{}{&header, &claims} {
+		data, err := b64.DecodeString(parts[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed token: %w", err)
+		}
+		if err := json.Unmarshal(data, dst); err != nil {
+			return nil, nil, fmt.Errorf("malformed token: %w", err)
+		}
+	}
+	return header, claims, nil
+}
+
+func verifyToken(token string, header, claims map[string]interface{}, key interface{}, now time.Time) error {
+	alg, h, err := algorithm(key)
+	if err != nil {
+		return err
+	}
+	if header["alg"] != alg {
+		return fmt.Errorf("token algorithm %v does not match key algorithm %s", header["alg"], alg)
+	}
+	i := strings.LastIndex(token, ".")
+	signingInput := token[:i]
+	signature, err := b64.DecodeString(token[i+1:])
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	digest := newHash(h)
+	_, _ = digest.Write([]byte(signingInput))
+	var valid bool
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		_, _ = mac.Write([]byte(signingInput))
+		valid = hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, h, digest.Sum(nil), signature) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(k, digest.Sum(nil), r, s)
+		}
+	default:
+		return fmt.Errorf("unsupported verification key type %T", key)
+	}
+	if !valid {
+		return errors.New("invalid token signature")
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return errors.New("token expired at " + strconv.FormatInt(int64(exp), 10))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenHMAC(t *testing.T) {
+	code, stdout, stderr := runCLI([]string{"token", "connect", "--secret", "s3cret", "--user", "42", "--channels", "a,b", "--info", `{"name":"x"}`}, "")
+	if code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr)
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr = runCLI([]string{"token", "decode", "--secret", "s3cret", out.Token}, "")
+	if code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr)
+	}
+	var decoded struct {
+		Claims   map[string]interface{} `json:"claims"`
+		Verified bool                   `json:"verified"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Verified || decoded.Claims["sub"] != "42" || len(decoded.Claims["channels"].([]interface{})) != 2 {
+		t.Fatalf("unexpected decode result: %s", stdout)
+	}
+	code, _, stderr = runCLI([]string{"token", "decode", "--secret", "wrong", out.Token}, "")
+	if code != exitError || !strings.Contains(stderr, "invalid token signature") {
+		t.Fatalf("expected signature error, got %d: %s", code, stderr)
+	}
+}
+
+func TestTokenECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := runCLI([]string{"--format", "table", "token", "subscribe", "--key-file", keyFile, "--user", "1", "--channel", "chat"}, "")
+	if code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr)
+	}
+	token := strings.TrimSpace(strings.Split(stdout, "\n")[1])
+	code, stdout, stderr = runCLI([]string{"token", "decode", "--key-file", keyFile, token}, "")
+	if code != exitOK || !strings.Contains(stdout, `"channel": "chat"`) || !strings.Contains(stdout, `"ES256"`) {
+		t.Fatalf("unexpected decode result %d: %s %s", code, stdout, stderr)
+	}
+}
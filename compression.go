@@ -0,0 +1,110 @@
+package gocent
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressionThreshold is a minimal size of request body in bytes to
+// compress.
+const DefaultCompressionThreshold = 1024
+
+// Compressor compresses request bodies and decompresses responses. Gzip is
+// built-in, other algorithms can be plugged in by implementing this
+// interface, for example zstd using github.com/klauspost/compress/zstd:
+//
+//	type zstdCompressor struct{}
+//
+//	func (zstdCompressor) Encoding() string { return "zstd" }
+//
+//	func (zstdCompressor) Compress(w io.Writer, data []byte) error {
+//		enc, err := zstd.NewWriter(w)
+//		if err != nil {
+//			return err
+//		}
+//		if _, err := enc.Write(data); err != nil {
+//			return err
+//		}
+//		return enc.Close()
+//	}
+//
+//	func (zstdCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+//		dec, err := zstd.NewReader(r)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return dec.IOReadCloser(), nil
+//	}
+type Compressor interface {
+	// Encoding is a name of algorithm used in Content-Encoding header.
+	Encoding() string
+	// Compress writes compressed data to w.
+	Compress(w io.Writer, data []byte) error
+	// Decompress returns reader of decompressed data from r.
+	Decompress(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompressor returns gzip Compressor with provided compression level,
+// see compress/gzip constants.
+func GzipCompressor(level int) Compressor {
+	return &gzipCompressor{level: level}
+}
+
+type gzipCompressor struct {
+	level   int
+	writers sync.Pool
+}
+
+func (c *gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (c *gzipCompressor) Compress(w io.Writer, data []byte) error {
+	zw, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(w)
+	} else {
+		var err error
+		zw, err = gzip.NewWriterLevel(w, c.level)
+		if err != nil {
+			return err
+		}
+	}
+	defer c.writers.Put(zw)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (c *gzipCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var defaultGzipCompressor = GzipCompressor(gzip.DefaultCompression)
+
+// acceptEncoding returns Accept-Encoding header value for compressor.
+func acceptEncoding(compressor Compressor) string {
+	if compressor.Encoding() == "gzip" {
+		return "gzip"
+	}
+	return compressor.Encoding() + ", gzip"
+}
+
+// decompressBody returns reader of response body decoded according to
+// Content-Encoding header.
+func decompressBody(body io.Reader, contentEncoding string, compressor Compressor) (io.ReadCloser, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(contentEncoding)); encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case compressor.Encoding():
+		return compressor.Decompress(body)
+	case "gzip":
+		return defaultGzipCompressor.Decompress(body)
+	default:
+		return nil, fmt.Errorf("unsupported response Content-Encoding %q", contentEncoding)
+	}
+}
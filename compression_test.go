@@ -0,0 +1,139 @@
+package gocent
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// flateCompressor is a Compressor plugged in tests.
+type flateCompressor struct{}
+
+func (flateCompressor) Encoding() string { return "deflate" }
+
+func (flateCompressor) Compress(w io.Writer, data []byte) error {
+	fw, err := flate.NewWriter(w, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+func (flateCompressor) Decompress(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+// compressionServer decodes compressed requests, remembers body sizes and
+// compresses responses according to Accept-Encoding header.
+type compressionServer struct {
+	mu               sync.Mutex
+	requestEncoding  string
+	responseEncoding string
+	wireSize         int
+	rawSize          int
+}
+
+func (s *compressionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wire, _ := io.ReadAll(r.Body)
+	var body io.Reader = bytes.NewReader(wire)
+	encoding := r.Header.Get("Content-Encoding")
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	case "deflate":
+		body = flate.NewReader(body)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := strings.Repeat(`{"result":{}}`+"\n", bytes.Count(raw, []byte("\n")))
+
+	accept := strings.Split(r.Header.Get("Accept-Encoding"), ",")
+	responseEncoding := strings.TrimSpace(accept[0])
+	var out bytes.Buffer
+	switch responseEncoding {
+	case "gzip":
+		_ = GzipCompressor(gzip.BestSpeed).Compress(&out, []byte(response))
+	case "deflate":
+		_ = flateCompressor{}.Compress(&out, []byte(response))
+	default:
+		responseEncoding = ""
+		out.WriteString(response)
+	}
+
+	s.mu.Lock()
+	s.requestEncoding, s.responseEncoding = encoding, responseEncoding
+	s.wireSize, s.rawSize = len(wire), len(raw)
+	s.mu.Unlock()
+
+	if responseEncoding != "" {
+		w.Header().Set("Content-Encoding", responseEncoding)
+	}
+	_, _ = w.Write(out.Bytes())
+}
+
+func TestClientCompression(t *testing.T) {
+	s := &compressionServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	data := []byte(`{"text":"` + strings.Repeat("hello ", 100) + `"}`)
+	channels := make([]string, 200)
+	for i := range channels {
+		channels[i] = "chat:room"
+	}
+
+	for _, compressor := range []Compressor{GzipCompressor(gzip.DefaultCompression), flateCompressor{}} {
+		c := New(Config{Addr: server.URL, Compression: compressor})
+		if _, err := c.Broadcast(context.Background(), channels, data); err != nil {
+			t.Fatal(err)
+		}
+		if s.requestEncoding != compressor.Encoding() || s.responseEncoding != compressor.Encoding() {
+			t.Fatalf("unexpected encodings: request %q, response %q", s.requestEncoding, s.responseEncoding)
+		}
+		if s.wireSize*10 > s.rawSize {
+			t.Fatalf("%s: body not compressed enough: %d bytes on wire, %d raw", compressor.Encoding(), s.wireSize, s.rawSize)
+		}
+		t.Logf("%s: %d bytes on wire, %d raw", compressor.Encoding(), s.wireSize, s.rawSize)
+
+		// Small bodies sent as is.
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if s.requestEncoding != "" || s.wireSize != s.rawSize {
+			t.Fatalf("small body compressed with %q", s.requestEncoding)
+		}
+	}
+
+	c := New(Config{Addr: server.URL, Compression: flateCompressor{}, CompressionThreshold: 1})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.requestEncoding != "deflate" {
+		t.Fatalf("expected body compressed with threshold 1, got %q", s.requestEncoding)
+	}
+}
+
+func TestDecompressBodyUnsupported(t *testing.T) {
+	_, err := decompressBody(strings.NewReader(""), "br", defaultGzipCompressor)
+	if err == nil {
+		t.Fatal("expected error for unsupported encoding")
+	}
+}
@@ -0,0 +1,181 @@
+package gocent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter limits number of in-flight requests to Centrifugo.
+type ConcurrencyLimiter interface {
+	// Acquire blocks until request is allowed to be sent. Returned function
+	// must be called when request finished with its latency and error.
+	Acquire(ctx context.Context) (release func(latency time.Duration, err error), err error)
+}
+
+// ErrConcurrencyLimited returned when request rejected by ConcurrencyLimiter.
+type ErrConcurrencyLimited struct {
+	// Limit of in-flight requests at the moment of rejection.
+	Limit int
+}
+
+func (e ErrConcurrencyLimited) Error() string {
+	return fmt.Sprintf("concurrency limit %d exceeded", e.Limit)
+}
+
+// AIMDConfig configures AIMDLimiter.
+type AIMDConfig struct {
+	// InitialLimit of in-flight requests. Zero value means 10.
+	InitialLimit int
+	// MinLimit of in-flight requests. Zero value means 1.
+	MinLimit int
+	// MaxLimit of in-flight requests. Zero value means 1000.
+	MaxLimit int
+	// BackoffRatio multiplies limit on overload. Zero value means 0.9.
+	BackoffRatio float64
+	// LatencyThreshold when set makes requests slower than threshold be
+	// considered as overload signal.
+	LatencyThreshold time.Duration
+	// MaxQueue limits number of calls waiting for in-flight request to
+	// finish, excess calls rejected with ErrConcurrencyLimited. Zero value
+	// means no limit, negative value means calls rejected without waiting.
+	MaxQueue int
+}
+
+// AIMDLimiter is a ConcurrencyLimiter which adjusts limit using additive
+// increase/multiplicative decrease algorithm: limit grows by one after limit
+// number of successful requests and decreases by BackoffRatio when request
+// failed with 5xx or 429 status code, timed out or was slower than
+// LatencyThreshold.
+type AIMDLimiter struct {
+	config AIMDConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+}
+
+// NewAIMDLimiter creates AIMDLimiter.
+func NewAIMDLimiter(c AIMDConfig) *AIMDLimiter {
+	if c.MinLimit <= 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = 1000
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = 10
+	}
+	if c.BackoffRatio <= 0 || c.BackoffRatio >= 1 {
+		c.BackoffRatio = 0.9
+	}
+	limit := math.Min(math.Max(float64(c.InitialLimit), float64(c.MinLimit)), float64(c.MaxLimit))
+	return &AIMDLimiter{config: c, limit: limit}
+}
+
+// Limit returns current limit of in-flight requests.
+func (l *AIMDLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns number of in-flight requests.
+func (l *AIMDLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// QueueLength returns number of calls waiting to send request.
+func (l *AIMDLimiter) QueueLength() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+// Acquire waits for free slot or returns ErrConcurrencyLimited when queue is
+// full.
+func (l *AIMDLimiter) Acquire(ctx context.Context) (func(time.Duration, error), error) {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if l.config.MaxQueue < 0 || (l.config.MaxQueue > 0 && len(l.waiters) >= l.config.MaxQueue) {
+		limit := int(l.limit)
+		l.mu.Unlock()
+		return nil, ErrConcurrencyLimited{Limit: limit}
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+
+	select {
+	case <-ch:
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, waiter := range l.waiters {
+			if waiter == ch {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				l.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		l.mu.Unlock()
+		// Slot was granted concurrently, pass it to next waiter.
+		l.finish(false, false)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *AIMDLimiter) release(latency time.Duration, err error) {
+	overload := isOverload(err) || (l.config.LatencyThreshold > 0 && latency > l.config.LatencyThreshold)
+	// Cancelled requests say nothing about server state.
+	success := err == nil && !overload
+	l.finish(overload, success)
+}
+
+func (l *AIMDLimiter) finish(overload, success bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Limit only grows while it's actually used.
+	utilized := float64(l.inFlight) >= l.limit/2
+	l.inFlight--
+	switch {
+	case overload:
+		l.limit = math.Max(float64(l.config.MinLimit), l.limit*l.config.BackoffRatio)
+	case success && utilized:
+		l.limit = math.Min(float64(l.config.MaxLimit), l.limit+1/l.limit)
+	}
+	for len(l.waiters) > 0 && l.inFlight < int(l.limit) {
+		ch := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+		close(ch)
+	}
+}
+
+// isOverload checks whether request error means that server is overloaded.
+func isOverload(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr ErrStatusCode
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
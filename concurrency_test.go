@@ -0,0 +1,148 @@
+package gocent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+	l := NewAIMDLimiter(AIMDConfig{InitialLimit: 4, MaxQueue: -1})
+	ctx := context.Background()
+	var releases []func(time.Duration, error)
+	for i := 0; i < 4; i++ {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	var limitErr ErrConcurrencyLimited
+	if _, err := l.Acquire(ctx); !errors.As(err, &limitErr) || limitErr.Limit != 4 {
+		t.Fatalf("expected ErrConcurrencyLimited, got %v", err)
+	}
+	if l.InFlight() != 4 {
+		t.Fatalf("unexpected in-flight requests: %d", l.InFlight())
+	}
+
+	// Successful requests under load increase limit by one per limit requests.
+	releases[3](time.Millisecond, nil)
+	for i := 0; i < 5; i++ {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(time.Millisecond, nil)
+	}
+	for _, release := range releases[:3] {
+		release(time.Millisecond, nil)
+	}
+	if l.Limit() != 5 {
+		t.Fatalf("expected limit 5, got %d", l.Limit())
+	}
+
+	// Overload decreases limit.
+	for _, err := range []error{ErrStatusCode{Code: http.StatusServiceUnavailable}, context.DeadlineExceeded} {
+		release, _ := l.Acquire(ctx)
+		release(time.Millisecond, err)
+	}
+	if l.Limit() != 4 {
+		t.Fatalf("expected limit to decrease, got %d", l.Limit())
+	}
+	// Errors not related to load do not change limit.
+	release, _ := l.Acquire(ctx)
+	release(time.Millisecond, ErrStatusCode{Code: http.StatusBadRequest})
+	if l.Limit() != 4 || l.InFlight() != 0 {
+		t.Fatalf("unexpected limiter state: limit %d, in-flight %d", l.Limit(), l.InFlight())
+	}
+}
+
+func TestAIMDLimiterQueue(t *testing.T) {
+	l := NewAIMDLimiter(AIMDConfig{InitialLimit: 1, MaxLimit: 1, MaxQueue: 1})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release(0, nil)
+		}
+		acquired <- err
+	}()
+	for l.QueueLength() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := l.Acquire(context.Background()); !errors.As(err, new(ErrConcurrencyLimited)) {
+		t.Fatalf("expected rejection with full queue, got %v", err)
+	}
+	release(0, nil)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	release, _ = l.Acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+	if l.QueueLength() != 0 {
+		t.Fatalf("cancelled call left in queue")
+	}
+	release(0, nil)
+}
+
+func TestClientConcurrencyLimiter(t *testing.T) {
+	var current, max int32
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	defer server.Close()
+
+	limiter := NewAIMDLimiter(AIMDConfig{InitialLimit: 3, MaxLimit: 3})
+	c := New(Config{Addr: server.URL, ConcurrencyLimiter: limiter})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Info(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&max) > 3 {
+		t.Fatalf("expected at most 3 concurrent requests, got %d", max)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	for i := 0; i < 3; i++ {
+		_, _ = c.Info(context.Background())
+	}
+	if limiter.Limit() >= 3 {
+		t.Fatalf("expected limit to decrease after server errors, got %d", limiter.Limit())
+	}
+}
@@ -0,0 +1,349 @@
+package gocent
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings which can be used in environment variables (upper case, with
+// prefix), DSN query parameters and config files (lower case).
+const (
+	settingDSN                 = "dsn"
+	settingAddr                = "addr"
+	settingKey                 = "key"
+	settingKeyFile             = "key_file"
+	settingTimeout             = "timeout"
+	settingRetries             = "retries"
+	settingMaxIdleConnsPerHost = "max_idle_conns_per_host"
+	settingTLSCAFile           = "tls_ca_file"
+	settingTLSCertFile         = "tls_cert_file"
+	settingTLSKeyFile          = "tls_key_file"
+	settingTLSServerName       = "tls_server_name"
+	settingTLSMinVersion       = "tls_min_version"
+)
+
+// dsnSchemes maps supported DSN schemes to API endpoint schemes.
+var dsnSchemes = map[string]string{
+	"centrifugo+http":  "http",
+	"centrifugo+https": "https",
+	"http":             "http",
+	"https":            "https",
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ConfigError returned when configuration value is malformed.
+type ConfigError struct {
+	// Source of value, for example environment variable name or file path with line.
+	Source string
+	Value  string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s value %q: %v", e.Source, e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigFromEnv creates Config from environment variables with provided
+// prefix. For prefix "CENTRIFUGO" the following variables are used:
+//
+//	CENTRIFUGO_DSN - DSN, see ParseDSN, other variables override values from it
+//	CENTRIFUGO_ADDR - API endpoint, comma-separated list for several endpoints
+//	CENTRIFUGO_KEY - API key
+//	CENTRIFUGO_KEY_FILE - path to file containing API key
+//	CENTRIFUGO_TIMEOUT - request timeout, for example 2s
+//	CENTRIFUGO_RETRIES - number of request retries
+//	CENTRIFUGO_MAX_IDLE_CONNS_PER_HOST - transport idle connections limit
+//	CENTRIFUGO_TLS_CA_FILE, CENTRIFUGO_TLS_CERT_FILE, CENTRIFUGO_TLS_KEY_FILE,
+//	CENTRIFUGO_TLS_SERVER_NAME, CENTRIFUGO_TLS_MIN_VERSION - TLS configuration
+func ConfigFromEnv(prefix string) (Config, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	var settings []setting
+	for _, name := range settingNames() {
+		envName := prefix + strings.ToUpper(name)
+		if value, ok := os.LookupEnv(envName); ok {
+			settings = append(settings, setting{name: name, value: value, source: envName})
+		}
+	}
+	return configFromSettings(settings)
+}
+
+// ConfigFromFile creates Config from plain text file with "name = value"
+// lines. Names are the same as DSN query parameters (see ParseDSN) plus addr,
+// key, key_file and dsn. Empty lines and lines starting with # are ignored.
+func ConfigFromFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer func() { _ = f.Close() }()
+	var settings []setting
+	scanner := bufio.NewScanner(f)
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", path, lineNum)
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return Config{}, &ConfigError{Source: source, Value: line, Err: errors.New("expected name = value")}
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+		if !isSetting(name) {
+			return Config{}, &ConfigError{Source: source, Value: name, Err: errors.New("unknown setting")}
+		}
+		settings = append(settings, setting{name: name, value: value, source: source + " " + name})
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, err
+	}
+	return configFromSettings(settings)
+}
+
+// ParseDSN creates Config from DSN like:
+//
+//	centrifugo+https://key@host:8000/api?timeout=2s&retries=3
+//
+// Several comma-separated hosts may be set to configure Config.Addrs:
+//
+//	centrifugo+http://key@node1:8000,node2:8000/api
+//
+// Supported query parameters: timeout, retries, max_idle_conns_per_host,
+// tls_ca_file, tls_cert_file, tls_key_file, tls_server_name and
+// tls_min_version (1.0, 1.1, 1.2 or 1.3). Schemes
+// centrifugo+http, centrifugo+https, http and https are supported.
+func ParseDSN(dsn string) (Config, error) {
+	settings, err := parseDSN(dsn, "DSN")
+	if err != nil {
+		return Config{}, err
+	}
+	return configFromSettings(settings)
+}
+
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+func settingNames() []string {
+	return []string{
+		settingDSN, settingAddr, settingKey, settingKeyFile, settingTimeout, settingRetries,
+		settingMaxIdleConnsPerHost, settingTLSCAFile, settingTLSCertFile, settingTLSKeyFile,
+		settingTLSServerName, settingTLSMinVersion,
+	}
+}
+
+func isSetting(name string) bool {
+	for _, n := range settingNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDSN converts DSN into a list of settings.
+func parseDSN(dsn string, source string) ([]setting, error) {
+	invalid := func(err error) error {
+		return &ConfigError{Source: source, Value: redactDSN(dsn), Err: err}
+	}
+	i := strings.Index(dsn, "://")
+	if i < 0 {
+		return nil, invalid(errors.New("missing scheme"))
+	}
+	scheme, ok := dsnSchemes[strings.ToLower(dsn[:i])]
+	if !ok {
+		return nil, invalid(fmt.Errorf("unsupported scheme %q", dsn[:i]))
+	}
+	rest := dsn[i+3:]
+	authority := rest
+	pathAndQuery := ""
+	if j := strings.IndexAny(rest, "/?"); j >= 0 {
+		authority, pathAndQuery = rest[:j], rest[j:]
+	}
+	var settings []setting
+	if j := strings.LastIndex(authority, "@"); j >= 0 {
+		key, err := url.PathUnescape(authority[:j])
+		if err != nil {
+			return nil, invalid(fmt.Errorf("malformed key: %w", err))
+		}
+		settings = append(settings, setting{name: settingKey, value: key, source: source + " key"})
+		authority = authority[j+1:]
+	}
+	u, err := url.Parse(pathAndQuery)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	var addrs []string
+	for _, host := range strings.Split(authority, ",") {
+		if host == "" {
+			return nil, invalid(errors.New("empty host"))
+		}
+		addr := &url.URL{Scheme: scheme, Host: host, Path: u.Path}
+		if _, err := url.Parse(addr.String()); err != nil {
+			return nil, invalid(err)
+		}
+		addrs = append(addrs, addr.String())
+	}
+	settings = append(settings, setting{name: settingAddr, value: strings.Join(addrs, ","), source: source + " host"})
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Endpoint and key are only set in DSN authority part.
+		dsnPart := name == settingDSN || name == settingAddr || name == settingKey || name == settingKeyFile
+		if dsnPart || !isSetting(name) {
+			return nil, invalid(fmt.Errorf("unknown parameter %q", name))
+		}
+		settings = append(settings, setting{name: name, value: query.Get(name), source: source + " " + name})
+	}
+	return settings, nil
+}
+
+// redactDSN hides API key in DSN for error messages.
+func redactDSN(dsn string) string {
+	i := strings.Index(dsn, "://")
+	if i < 0 {
+		return dsn
+	}
+	rest := dsn[i+3:]
+	end := strings.IndexAny(rest, "/?")
+	if end < 0 {
+		end = len(rest)
+	}
+	if j := strings.LastIndex(rest[:end], "@"); j >= 0 {
+		return dsn[:i+3] + "xxxxx" + rest[j:]
+	}
+	return dsn
+}
+
+func configFromSettings(settings []setting) (Config, error) {
+	var c Config
+	// DSN applied first so other settings could override its values.
+	sort.SliceStable(settings, func(i, j int) bool {
+		return settings[i].name == settingDSN && settings[j].name != settingDSN
+	})
+	for _, s := range settings {
+		invalid := func(err error) error {
+			return &ConfigError{Source: s.source, Value: s.value, Err: err}
+		}
+		switch s.name {
+		case settingDSN:
+			dsnSettings, err := parseDSN(s.value, s.source)
+			if err != nil {
+				return Config{}, err
+			}
+			dsnConfig, err := configFromSettings(dsnSettings)
+			if err != nil {
+				return Config{}, err
+			}
+			c = dsnConfig
+		case settingAddr:
+			var addrs []string
+			for _, addr := range strings.Split(s.value, ",") {
+				addr = strings.TrimSpace(addr)
+				u, err := url.Parse(addr)
+				if err != nil {
+					return Config{}, invalid(err)
+				}
+				if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "unix" {
+					return Config{}, invalid(errors.New("http, https or unix endpoint expected"))
+				}
+				addrs = append(addrs, addr)
+			}
+			c.Addr, c.Addrs = addrs[0], nil
+			if len(addrs) > 1 {
+				c.Addrs = addrs
+			}
+		case settingKey:
+			c.Key = s.value
+		case settingKeyFile:
+			data, err := os.ReadFile(s.value)
+			if err != nil {
+				return Config{}, invalid(err)
+			}
+			c.Key = strings.TrimSpace(string(data))
+		case settingTimeout:
+			d, err := time.ParseDuration(s.value)
+			if err != nil {
+				return Config{}, invalid(err)
+			}
+			if d < 0 {
+				return Config{}, invalid(errors.New("must not be negative"))
+			}
+			c.Timeout = d
+		case settingRetries:
+			n, err := strconv.Atoi(s.value)
+			if err != nil {
+				return Config{}, invalid(err)
+			}
+			if n < 0 {
+				return Config{}, invalid(errors.New("must not be negative"))
+			}
+			c.Retries = n
+		case settingMaxIdleConnsPerHost:
+			n, err := strconv.Atoi(s.value)
+			if err != nil {
+				return Config{}, invalid(err)
+			}
+			if n < 0 {
+				return Config{}, invalid(errors.New("must not be negative"))
+			}
+			c.MaxIdleConnsPerHost = n
+		case settingTLSCAFile:
+			tlsConfig(&c).CAFile = s.value
+		case settingTLSCertFile:
+			tlsConfig(&c).CertFile = s.value
+		case settingTLSKeyFile:
+			tlsConfig(&c).KeyFile = s.value
+		case settingTLSServerName:
+			tlsConfig(&c).ServerName = s.value
+		case settingTLSMinVersion:
+			version, ok := tlsVersions[s.value]
+			if !ok {
+				return Config{}, invalid(errors.New("one of 1.0, 1.1, 1.2 or 1.3 expected"))
+			}
+			tlsConfig(&c).MinVersion = version
+		}
+	}
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
+
+func tlsConfig(c *Config) *TLSConfig {
+	if c.TLS == nil {
+		c.TLS = &TLSConfig{}
+	}
+	return c.TLS
+}
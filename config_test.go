@@ -0,0 +1,119 @@
+package gocent
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	c, err := ParseDSN("centrifugo+https://se%2Fcret@host:8000/api?timeout=2s&retries=3&max_idle_conns_per_host=10&tls_server_name=example.com&tls_min_version=1.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != "https://host:8000/api" || c.Addrs != nil || c.Key != "se/cret" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if c.Timeout != 2*time.Second || c.Retries != 3 || c.MaxIdleConnsPerHost != 10 {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if c.TLS == nil || c.TLS.ServerName != "example.com" || c.TLS.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected TLS config: %+v", c.TLS)
+	}
+
+	c, err = ParseDSN("centrifugo+http://node1:8000,node2:8000/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.Addrs, " ") != "http://node1:8000/api http://node2:8000/api" || c.Key != "" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	for _, dsn := range []string{
+		"host:8000/api",
+		"redis://host:8000",
+		"centrifugo+http://key@host/api?timeout=abc",
+		"centrifugo+http://key@host/api?max_idle_conns_per_host=-1",
+		"centrifugo+http://key@host/api?retries=-1",
+		"centrifugo+http://key@host/api?unknown=1",
+		"centrifugo+http://key@/api",
+		"centrifugo+http://key@host,/api",
+		"centrifugo+http://key@host/api?tls_cert_file=cert.pem",
+	} {
+		_, err := ParseDSN(dsn)
+		if err == nil {
+			t.Fatalf("expected error for %s", dsn)
+		}
+		if strings.Contains(err.Error(), "key@") {
+			t.Fatalf("API key leaked in error: %v", err)
+		}
+	}
+	_, err := ParseDSN("centrifugo+http://key@host/api?timeout=abc")
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Source != "DSN timeout" || configErr.Value != "abc" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"TEST_GOCENT_DSN":                     "centrifugo+http://dsnkey@host:8000/api?timeout=2s",
+		"TEST_GOCENT_KEY":                     "envkey",
+		"TEST_GOCENT_MAX_IDLE_CONNS_PER_HOST": "2",
+	}
+	for name, value := range env {
+		_ = os.Setenv(name, value)
+	}
+	defer func() {
+		for name := range env {
+			_ = os.Unsetenv(name)
+		}
+	}()
+	c, err := ConfigFromEnv("TEST_GOCENT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != "http://host:8000/api" || c.Key != "envkey" || c.Timeout != 2*time.Second || c.MaxIdleConnsPerHost != 2 {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	_ = os.Setenv("TEST_GOCENT_MAX_IDLE_CONNS_PER_HOST", "many")
+	_, err = ConfigFromEnv("TEST_GOCENT_")
+	if err == nil || !strings.Contains(err.Error(), "TEST_GOCENT_MAX_IDLE_CONNS_PER_HOST") {
+		t.Fatalf("expected descriptive error, got %v", err)
+	}
+}
+
+func TestConfigFromFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("filekey\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "gocent.conf")
+	content := "# Centrifugo API\naddr = http://a:8000/api, http://b:8000/api\nkey_file = " + keyFile + "\ntimeout = \"500ms\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Addrs) != 2 || c.Key != "filekey" || c.Timeout != 500*time.Millisecond {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte("addr = ftp://host\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ConfigFromFile(path)
+	if err == nil || !strings.Contains(err.Error(), path+":1 addr") {
+		t.Fatalf("expected descriptive error, got %v", err)
+	}
+}
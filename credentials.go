@@ -0,0 +1,94 @@
+package gocent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CredentialsProvider provides API keys to authorize requests with. It's
+// consulted before every API call so keys can be rotated without creating
+// new Client.
+type CredentialsProvider interface {
+	// APIKeys returns API keys to use. Keys are tried in order: when server
+	// responds with 401 status code request is sent again with next key.
+	// Empty result means sending requests without Authorization header.
+	APIKeys(ctx context.Context) ([]string, error)
+}
+
+// StaticCredentials returns CredentialsProvider which always provides the
+// same API key.
+func StaticCredentials(key string) CredentialsProvider {
+	if key == "" {
+		return MultiKeyCredentials()
+	}
+	return MultiKeyCredentials(key)
+}
+
+// MultiKeyCredentials returns CredentialsProvider with several API keys which
+// are tried in order on 401 responses. Useful during key rotation window:
+// new key may be set first while old one is still accepted by some servers.
+func MultiKeyCredentials(keys ...string) CredentialsProvider {
+	return multiKeyCredentials(append([]string(nil), keys...))
+}
+
+type multiKeyCredentials []string
+
+func (c multiKeyCredentials) APIKeys(context.Context) ([]string, error) {
+	return c, nil
+}
+
+// FileCredentials provides API keys stored in file, one key per line. File is
+// checked for modifications on every call and reloaded when changed. Several
+// lines may be used during rotation window, they are tried in order on 401
+// responses. Empty lines and lines starting with # are ignored.
+type FileCredentials struct {
+	path string
+
+	mu    sync.Mutex
+	keys  []string
+	stamp []fileStamp
+}
+
+// NewFileCredentials creates FileCredentials and loads keys from file.
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	c := &FileCredentials{path: path}
+	if _, err := c.APIKeys(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// APIKeys returns keys from file. If file can't be read or contains no keys
+// after it was changed previously loaded keys returned.
+func (c *FileCredentials) APIKeys(context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stamp := statFiles(c.path)
+	if c.stamp != nil && stampsEqual(stamp, c.stamp) {
+		return c.keys, nil
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if c.stamp != nil {
+			return c.keys, nil
+		}
+		return nil, fmt.Errorf("error reading API key file: %w", err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 && c.stamp != nil {
+		// File may be truncated while being rewritten.
+		return c.keys, nil
+	}
+	c.keys, c.stamp = keys, stamp
+	return c.keys, nil
+}
@@ -0,0 +1,118 @@
+package gocent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// keyServer accepts requests authorized with one of valid keys and counts
+// requests per key.
+type keyServer struct {
+	mu       sync.Mutex
+	valid    map[string]bool
+	requests map[string]int
+}
+
+func newKeyServer(keys ...string) *keyServer {
+	s := &keyServer{valid: map[string]bool{}, requests: map[string]int{}}
+	s.setKeys(keys...)
+	return s
+}
+
+func (s *keyServer) setKeys(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valid = map[string]bool{}
+	for _, key := range keys {
+		s.valid["apikey "+key] = true
+	}
+}
+
+func (s *keyServer) count(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests["apikey "+key]
+}
+
+func (s *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auth := r.Header.Get("Authorization")
+	s.requests[auth]++
+	if !s.valid[auth] {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = w.Write([]byte(`{"result":{}}`))
+}
+
+func TestMultiKeyCredentials(t *testing.T) {
+	keys := newKeyServer("old")
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	c := New(Config{Addr: server.URL, Credentials: MultiKeyCredentials("new", "old")})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Accepted key remembered so new key rejected only once.
+	if keys.count("new") != 1 || keys.count("old") != 3 {
+		t.Fatalf("unexpected requests: new %d, old %d", keys.count("new"), keys.count("old"))
+	}
+
+	keys.setKeys("new")
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if keys.count("new") != 2 {
+		t.Fatalf("expected request with new key, got %d", keys.count("new"))
+	}
+
+	keys.setKeys("other")
+	_, err := c.Info(context.Background())
+	if statusErr, ok := err.(ErrStatusCode); !ok || statusErr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 status code error, got %v", err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	keys := newKeyServer("first")
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "key")
+	writeTestFile(t, path, []byte("first\n"))
+	credentials, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(Config{Addr: server.URL, Credentials: credentials})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, path, []byte("# rotation\nsecond\nfirst\n"))
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	keys.setKeys("second")
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated file does not drop loaded keys.
+	writeTestFile(t, path, nil)
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileCredentials(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
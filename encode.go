@@ -0,0 +1,409 @@
+package gocent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxPooledBufferSize limits size of buffers returned to pool so occasional
+// huge requests do not pin memory.
+const maxPooledBufferSize = 1 << 20
+
+// byteBuffer is a growable buffer to encode requests into.
+type byteBuffer struct {
+	b []byte
+}
+
+func (w *byteBuffer) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &byteBuffer{b: make([]byte, 0, 1024)}
+	},
+}
+
+func getBuffer() *byteBuffer {
+	buf := bufferPool.Get().(*byteBuffer)
+	buf.b = buf.b[:0]
+	return buf
+}
+
+func putBuffer(buf *byteBuffer) {
+	if cap(buf.b) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// encodeCommands appends commands as JSON lines to buf. Commands with known
+// params encoded without reflection, others with encoding/json.
+func encodeCommands(buf *byteBuffer, commands []Command) error {
+	for _, cmd := range commands {
+		var err error
+		buf.b, err = appendCommand(buf.b, cmd)
+		if err != nil {
+			return err
+		}
+		buf.b = append(buf.b, '\n')
+	}
+	return nil
+}
+
+func appendCommand(b []byte, cmd Command) ([]byte, error) {
+	start := len(b)
+	b = append(b, `{"method":`...)
+	b = appendString(b, cmd.Method)
+	b = append(b, `,"params":`...)
+	var err error
+	switch params := cmd.Params.(type) {
+	case publishRequest:
+		b, err = params.appendJSON(b)
+	case broadcastRequest:
+		b, err = params.appendJSON(b)
+	case subscribeRequest:
+		b, err = params.appendJSON(b)
+	case unsubscribeRequest:
+		b = params.appendJSON(b)
+	case disconnectRequest:
+		b = params.appendJSON(b)
+	case channelRequest:
+		b = params.appendJSON(b)
+	case historyRequest:
+		b = params.appendJSON(b)
+	case channelsRequest:
+		b = params.appendJSON(b)
+	case infoRequest:
+		b = append(b, "{}"...)
+	default:
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			return b[:start], err
+		}
+		return append(b[:start], data...), nil
+	}
+	if err != nil {
+		return b[:start], err
+	}
+	return append(b, '}'), nil
+}
+
+func (r publishRequest) appendJSON(b []byte) ([]byte, error) {
+	b = append(b, `{"channel":`...)
+	b = appendString(b, r.Channel)
+	b = append(b, `,"data":`...)
+	b, err := appendRawMessage(b, r.Data)
+	if err != nil {
+		return b, err
+	}
+	return append(r.PublishOptions.appendFields(b), '}'), nil
+}
+
+func (r broadcastRequest) appendJSON(b []byte) ([]byte, error) {
+	b = append(b, `{"channels":`...)
+	b = appendStrings(b, r.Channels)
+	b = append(b, `,"data":`...)
+	b, err := appendRawMessage(b, r.Data)
+	if err != nil {
+		return b, err
+	}
+	return append(r.PublishOptions.appendFields(b), '}'), nil
+}
+
+func (o PublishOptions) appendFields(b []byte) []byte {
+	if o.SkipHistory {
+		b = append(b, `,"skip_history":true`...)
+	}
+	if o.IdempotencyKey != "" {
+		b = append(b, `,"idempotency_key":`...)
+		b = appendString(b, o.IdempotencyKey)
+	}
+	return b
+}
+
+func (r subscribeRequest) appendJSON(b []byte) ([]byte, error) {
+	b = append(b, `{"channel":`...)
+	b = appendString(b, r.Channel)
+	b = append(b, `,"user":`...)
+	b = appendString(b, r.User)
+	var err error
+	if len(r.Info) > 0 {
+		b = append(b, `,"info":`...)
+		if b, err = appendRawMessage(b, r.Info); err != nil {
+			return b, err
+		}
+	}
+	if r.Presence {
+		b = append(b, `,"presence":true`...)
+	}
+	if r.JoinLeave {
+		b = append(b, `,"join_leave":true`...)
+	}
+	if r.Position {
+		b = append(b, `,"position":true`...)
+	}
+	if r.Recover {
+		b = append(b, `,"recover":true`...)
+	}
+	if len(r.Data) > 0 {
+		b = append(b, `,"data":`...)
+		if b, err = appendRawMessage(b, r.Data); err != nil {
+			return b, err
+		}
+	}
+	if r.RecoverSince != nil {
+		b = append(b, `,"recover_since":`...)
+		b = r.RecoverSince.appendJSON(b)
+	}
+	if r.ClientID != "" {
+		b = append(b, `,"client":`...)
+		b = appendString(b, r.ClientID)
+	}
+	return append(b, '}'), nil
+}
+
+func (r unsubscribeRequest) appendJSON(b []byte) []byte {
+	b = append(b, `{"channel":`...)
+	b = appendString(b, r.Channel)
+	b = append(b, `,"user":`...)
+	b = appendString(b, r.User)
+	if r.ClientID != "" {
+		b = append(b, `,"client":`...)
+		b = appendString(b, r.ClientID)
+	}
+	return append(b, '}')
+}
+
+func (r disconnectRequest) appendJSON(b []byte) []byte {
+	b = append(b, `{"user":`...)
+	b = appendString(b, r.User)
+	// Disconnect and ClientWhitelist have no JSON tags so encoded with Go
+	// field names, kept as is for compatibility.
+	b = append(b, `,"Disconnect":`...)
+	if r.Disconnect == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '{')
+		if r.Disconnect.Code != 0 {
+			b = append(b, `"code":`...)
+			b = strconv.AppendUint(b, uint64(r.Disconnect.Code), 10)
+			b = append(b, ',')
+		}
+		b = append(b, `"reason":`...)
+		b = appendString(b, r.Disconnect.Reason)
+		b = append(b, `,"reconnect":`...)
+		b = strconv.AppendBool(b, r.Disconnect.Reconnect)
+		b = append(b, '}')
+	}
+	b = append(b, `,"ClientWhitelist":`...)
+	b = appendStrings(b, r.ClientWhitelist)
+	if r.ClientID != "" {
+		b = append(b, `,"client":`...)
+		b = appendString(b, r.ClientID)
+	}
+	return append(b, '}')
+}
+
+func (r channelRequest) appendJSON(b []byte) []byte {
+	b = append(b, `{"channel":`...)
+	b = appendString(b, r.Channel)
+	return append(b, '}')
+}
+
+func (r historyRequest) appendJSON(b []byte) []byte {
+	b = append(b, `{"channel":`...)
+	b = appendString(b, r.Channel)
+	if r.Since != nil {
+		b = append(b, `,"since":`...)
+		b = r.Since.appendJSON(b)
+	}
+	if r.Limit != 0 {
+		b = append(b, `,"limit":`...)
+		b = strconv.AppendInt(b, int64(r.Limit), 10)
+	}
+	if r.Reverse {
+		b = append(b, `,"reverse":true`...)
+	}
+	return append(b, '}')
+}
+
+func (r channelsRequest) appendJSON(b []byte) []byte {
+	if r.Pattern == "" {
+		return append(b, "{}"...)
+	}
+	b = append(b, `{"pattern":`...)
+	b = appendString(b, r.Pattern)
+	return append(b, '}')
+}
+
+func (p *StreamPosition) appendJSON(b []byte) []byte {
+	b = append(b, '{')
+	if p.Offset != 0 {
+		b = append(b, `"offset":`...)
+		b = strconv.AppendUint(b, p.Offset, 10)
+	}
+	if p.Epoch != "" {
+		if p.Offset != 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `"epoch":`...)
+		b = appendString(b, p.Epoch)
+	}
+	return append(b, '}')
+}
+
+func appendStrings(b []byte, values []string) []byte {
+	if values == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendString(b, v)
+	}
+	return append(b, ']')
+}
+
+// appendRawMessage appends validated and compacted JSON like encoding/json
+// does for json.RawMessage.
+func appendRawMessage(b []byte, data json.RawMessage) ([]byte, error) {
+	if data == nil {
+		return append(b, "null"...), nil
+	}
+	if json.Valid(data) && isCompact(data) {
+		return append(b, data...), nil
+	}
+	buf := bytes.NewBuffer(b)
+	if err := json.Compact(buf, data); err != nil {
+		return b, &json.MarshalerError{Type: reflect.TypeOf(data), Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+// isCompact reports whether JSON contains no whitespace outside of strings.
+func isCompact(data []byte) bool {
+	var inString, escaped bool
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case !inString && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			return false
+		}
+	}
+	return true
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends JSON string escaped the same way as encoding/json
+// does with HTML escaping enabled.
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are escaped for JSONP compatibility.
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// bodyTracker tracks readers of pooled request body. Transport may close
+// request body after RoundTrip returned, so buffer can only be reused when
+// all readers were closed.
+type bodyTracker struct {
+	data []byte
+	open int32
+}
+
+func (t *bodyTracker) newReader() io.ReadCloser {
+	atomic.AddInt32(&t.open, 1)
+	return &trackedReader{Reader: bytes.NewReader(t.data), tracker: t}
+}
+
+// released reports whether all readers were closed.
+func (t *bodyTracker) released() bool {
+	return atomic.LoadInt32(&t.open) == 0
+}
+
+type trackedReader struct {
+	*bytes.Reader
+	tracker *bodyTracker
+	closed  int32
+}
+
+func (r *trackedReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		atomic.AddInt32(&r.tracker.open, -1)
+	}
+	return nil
+}
+
+// decodeReplies decodes replies from r calling fn for each one as soon as it
+// is decoded.
+func decodeReplies(r io.Reader, fn func(i int, rep Reply) error) error {
+	dec := json.NewDecoder(r)
+	for i := 0; ; i++ {
+		var rep Reply
+		if err := dec.Decode(&rep); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(i, rep); err != nil {
+			return err
+		}
+	}
+}
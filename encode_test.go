@@ -0,0 +1,136 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func testCommands() []Command {
+	tricky := "<b>\"quoted\" & \\ \n\t\x01 юникод   \xff</b>"
+	data := json.RawMessage(`{"text": "hello", "n": [1, 2, 3]}`)
+	return []Command{
+		{Method: "publish", Params: publishRequest{Channel: tricky, Data: data}},
+		{Method: "publish", Params: publishRequest{Channel: "ch", Data: []byte(`{}`), PublishOptions: PublishOptions{SkipHistory: true, IdempotencyKey: "k"}}},
+		{Method: "broadcast", Params: broadcastRequest{Channels: []string{"a", tricky}, Data: data}},
+		{Method: "broadcast", Params: broadcastRequest{Data: []byte(`"s"`)}},
+		{Method: "subscribe", Params: subscribeRequest{Channel: "ch", User: "u"}},
+		{Method: "subscribe", Params: subscribeRequest{Channel: "ch", User: "u", SubscribeOptions: SubscribeOptions{
+			Info: []byte(`{"a":1}`), Presence: true, JoinLeave: true, Position: true, Recover: true,
+			Data: data, RecoverSince: &StreamPosition{Offset: 10, Epoch: "e"}, ClientID: "c",
+		}}},
+		{Method: "unsubscribe", Params: unsubscribeRequest{Channel: "ch", User: "u", UnsubscribeOptions: UnsubscribeOptions{ClientID: "c"}}},
+		{Method: "disconnect", Params: disconnectRequest{User: "u"}},
+		{Method: "disconnect", Params: disconnectRequest{User: "u", DisconnectOptions: DisconnectOptions{
+			Disconnect: &Disconnect{Code: 4000, Reason: "bye", Reconnect: true}, ClientWhitelist: []string{"c1"}, ClientID: "c",
+		}}},
+		{Method: "presence", Params: channelRequest{Channel: "ch"}},
+		{Method: "history", Params: historyRequest{Channel: "ch"}},
+		{Method: "history", Params: historyRequest{Channel: "ch", HistoryOptions: HistoryOptions{Since: &StreamPosition{Epoch: "e"}, Limit: NoLimit, Reverse: true}}},
+		{Method: "channels", Params: channelsRequest{}},
+		{Method: "channels", Params: channelsRequest{Pattern: "chat:*"}},
+		{Method: "info", Params: infoRequest{}},
+		{Method: "custom", Params: map[string]interface{}{"x": 1}},
+	}
+}
+
+func TestEncodeCommandsMatchesEncodingJSON(t *testing.T) {
+	for _, cmd := range testCommands() {
+		buf := &byteBuffer{}
+		if err := encodeCommands(buf, []Command{cmd}); err != nil {
+			t.Fatal(err)
+		}
+		expected, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(buf.b, []byte("\n")) || bytes.Count(buf.b, []byte("\n")) != 1 {
+			t.Fatalf("expected one JSON line, got %q", buf.b)
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(buf.b, &got); err != nil {
+			t.Fatalf("invalid JSON %s: %v", buf.b, err)
+		}
+		_ = json.Unmarshal(expected, &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: encoded\n%s\nexpected\n%s", cmd.Method, buf.b, expected)
+		}
+	}
+}
+
+func TestEncodeCommandsInvalidData(t *testing.T) {
+	buf := &byteBuffer{}
+	cmd := Command{Method: "publish", Params: publishRequest{Channel: "ch", Data: []byte(`{"broken"`)}}
+	if err := encodeCommands(buf, []Command{cmd}); err == nil {
+		t.Fatal("expected error for invalid data")
+	}
+}
+
+func TestEncodeCommandsAllocations(t *testing.T) {
+	commands := []Command{
+		{Method: "publish", Params: publishRequest{Channel: "chat:index", Data: []byte(`{"text":"hello"}`)}},
+		{Method: "history", Params: historyRequest{Channel: "chat:index", HistoryOptions: HistoryOptions{Limit: 10}}},
+	}
+	buf := &byteBuffer{}
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.b = buf.b[:0]
+		_ = encodeCommands(buf, commands)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+func benchmarkCommands() []Command {
+	data := []byte(`{"text":"hello world","user":{"id":"42","name":"Alexander"}}`)
+	commands := make([]Command, 0, 100)
+	for i := 0; i < 100; i++ {
+		commands = append(commands, Command{Method: "publish", Params: publishRequest{Channel: "chat:index", Data: data}})
+	}
+	return commands
+}
+
+func BenchmarkEncodeCommands(b *testing.B) {
+	commands := benchmarkCommands()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := getBuffer()
+		if err := encodeCommands(buf, commands); err != nil {
+			b.Fatal(err)
+		}
+		putBuffer(buf)
+	}
+}
+
+func BenchmarkEncodeCommandsEncodingJSON(b *testing.B) {
+	commands := benchmarkCommands()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, cmd := range commands {
+			if err := enc.Encode(cmd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkClientPublish(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{"offset":1,"epoch":"e"}}` + "\n"))
+	}))
+	defer server.Close()
+	c := New(Config{Addr: server.URL})
+	data := []byte(`{"text":"hello world"}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Publish(context.Background(), "chat:index", data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
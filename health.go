@@ -0,0 +1,229 @@
+package gocent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthRule checks info of cluster and returns error describing problem
+// when cluster is unhealthy.
+type HealthRule func(info InfoResult) error
+
+// HealthConfig configures HealthChecker.
+type HealthConfig struct {
+	// Interval between checks. Zero value means 10 seconds.
+	Interval time.Duration
+	// Timeout of check. Zero value means 5 seconds.
+	Timeout time.Duration
+	// MinNodes is a minimal number of running nodes. Zero value means 1.
+	MinNodes int
+	// MaxVersions is a maximal number of distinct Centrifugo versions
+	// running at the same time, for example 2 allows rolling upgrade. How far
+	// versions are apart is not checked. Zero value means versions are not
+	// checked.
+	MaxVersions int
+	// MaxClientsPerNode is a maximal number of clients connected to node.
+	// Zero value means number of clients is not checked.
+	MaxClientsPerNode int
+	// Rules are additional checks of cluster info.
+	Rules []HealthRule
+	// SkipUnhealthy allows to exclude endpoints failed last check from
+	// round-robin over Config.Addrs while at least one endpoint is healthy.
+	// All endpoints are used again when Run returns.
+	SkipUnhealthy bool
+}
+
+// HealthStatus is a result of health check.
+type HealthStatus struct {
+	// Healthy is true when at least one endpoint is healthy.
+	Healthy bool `json:"healthy"`
+	// CheckedAt is a time of check, zero if check was not done yet.
+	CheckedAt time.Time `json:"checked_at"`
+	// Endpoints contains status of every checked endpoint.
+	Endpoints []EndpointHealth `json:"endpoints"`
+}
+
+// EndpointHealth is a health status of server endpoint.
+type EndpointHealth struct {
+	// Endpoint address, empty when Config.GetAddr used.
+	Endpoint string `json:"endpoint"`
+	// Healthy is true when info request succeeded and all rules passed.
+	Healthy bool `json:"healthy"`
+	// Problems found during check.
+	Problems []string `json:"problems,omitempty"`
+	// NumNodes is a number of nodes reported by endpoint.
+	NumNodes int `json:"num_nodes"`
+}
+
+// HealthChecker periodically calls Info and evaluates rules over result,
+// for every endpoint when several Addrs configured. Last status is cached,
+// HealthChecker serves it over HTTP with 200 or 503 status code so can be
+// used as readiness probe.
+type HealthChecker struct {
+	client *Client
+	config HealthConfig
+
+	mu     sync.RWMutex
+	status HealthStatus
+}
+
+// NewHealthChecker creates HealthChecker, call Run to start checks.
+func NewHealthChecker(c *Client, config HealthConfig) *HealthChecker {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.MinNodes <= 0 {
+		config.MinNodes = 1
+	}
+	return &HealthChecker{client: c, config: config}
+}
+
+// Run checks health every Interval until ctx done.
+func (h *HealthChecker) Run(ctx context.Context) {
+	if h.config.SkipUnhealthy {
+		// Results are not updated anymore, so endpoints are not skipped.
+		defer h.client.health.store(nil)
+	}
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		h.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns result of last check.
+func (h *HealthChecker) Status() HealthStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+// Check checks health immediately and returns status.
+func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.config.Timeout)
+	defer cancel()
+
+	endpoints := h.client.endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{h.client.endpoint}
+		if h.client.getEndpoint != nil {
+			endpoints = []string{""}
+		}
+	}
+	status := HealthStatus{Endpoints: make([]EndpointHealth, len(endpoints))}
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			status.Endpoints[i] = h.checkEndpoint(ctx, endpoint)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	unhealthy := make(map[string]struct{})
+	for _, e := range status.Endpoints {
+		if e.Healthy {
+			status.Healthy = true
+		} else {
+			unhealthy[e.Endpoint] = struct{}{}
+		}
+	}
+	if h.config.SkipUnhealthy {
+		h.client.health.store(unhealthy)
+	}
+	status.CheckedAt = time.Now()
+	h.mu.Lock()
+	h.status = status
+	h.mu.Unlock()
+	return status
+}
+
+func (h *HealthChecker) checkEndpoint(ctx context.Context, endpoint string) EndpointHealth {
+	c := h.client
+	if endpoint != "" {
+		// Endpoint checked directly, bypassing limits and failover.
+		c = c.clone()
+		c.endpoint, c.endpoints = endpoint, nil
+		c.retries, c.hedge = 0, nil
+		c.rateLimiter, c.limiter = nil, nil
+	}
+	result := EndpointHealth{Endpoint: endpoint}
+	info, err := c.Info(ctx)
+	if err != nil {
+		result.Problems = []string{err.Error()}
+		return result
+	}
+	result.NumNodes = len(info.Nodes)
+	result.Problems = h.evaluate(info)
+	result.Healthy = len(result.Problems) == 0
+	return result
+}
+
+func (h *HealthChecker) evaluate(info InfoResult) []string {
+	var problems []string
+	if len(info.Nodes) < h.config.MinNodes {
+		problems = append(problems, fmt.Sprintf("%d nodes running, expected at least %d", len(info.Nodes), h.config.MinNodes))
+	}
+	if h.config.MaxVersions > 0 {
+		if versions := info.Summary().Versions; len(versions) > h.config.MaxVersions {
+			problems = append(problems, fmt.Sprintf("%d versions running, expected at most %d", len(versions), h.config.MaxVersions))
+		}
+	}
+	if h.config.MaxClientsPerNode > 0 {
+		for _, node := range info.Nodes {
+			if node.NumClients > h.config.MaxClientsPerNode {
+				problems = append(problems, fmt.Sprintf("node %s has %d clients, expected at most %d", node.Name, node.NumClients, h.config.MaxClientsPerNode))
+			}
+		}
+	}
+	for _, rule := range h.config.Rules {
+		if err := rule(info); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// ServeHTTP writes last status as JSON with 200 status code if healthy and
+// 503 otherwise.
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	status := h.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// endpointHealth keeps endpoints skipped by round-robin.
+type endpointHealth struct {
+	unhealthy atomic.Value // map[string]struct{}
+}
+
+func (e *endpointHealth) load() map[string]struct{} {
+	if e == nil {
+		return nil
+	}
+	unhealthy, _ := e.unhealthy.Load().(map[string]struct{})
+	return unhealthy
+}
+
+func (e *endpointHealth) store(unhealthy map[string]struct{}) {
+	e.unhealthy.Store(unhealthy)
+}
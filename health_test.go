@@ -0,0 +1,106 @@
+package gocent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newInfoServer(reply string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if reply == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(reply))
+	}))
+}
+
+func TestHealthChecker(t *testing.T) {
+	var healthyRequests, failingRequests int32
+	healthy := newInfoServer(`{"result":{"nodes":[{"name":"a","version":"3.1.0","num_clients":5},{"name":"b","version":"3.1.0","num_clients":50}]}}`, &healthyRequests)
+	defer healthy.Close()
+	failing := newInfoServer("", &failingRequests)
+	defer failing.Close()
+
+	c := New(Config{Addrs: []string{failing.URL, healthy.URL}})
+	h := NewHealthChecker(c, HealthConfig{MinNodes: 2, SkipUnhealthy: true})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before first check, got %d", recorder.Code)
+	}
+
+	status := h.Check(context.Background())
+	if !status.Healthy || len(status.Endpoints) != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if e := status.Endpoints[0]; e.Endpoint != failing.URL || e.Healthy || len(e.Problems) != 1 {
+		t.Fatalf("expected failing endpoint unhealthy, got %+v", e)
+	}
+	if e := status.Endpoints[1]; !e.Healthy || e.NumNodes != 2 {
+		t.Fatalf("expected healthy endpoint, got %+v", e)
+	}
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var served HealthStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusOK || !served.Healthy || len(served.Endpoints) != 2 {
+		t.Fatalf("unexpected response %d %+v", recorder.Code, served)
+	}
+
+	// Unhealthy endpoint skipped by round-robin.
+	before := atomic.LoadInt32(&failingRequests)
+	for i := 0; i < 4; i++ {
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&failingRequests) != before {
+		t.Fatal("request sent to unhealthy endpoint")
+	}
+
+	// Endpoints not skipped after Run returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Run(ctx)
+	for i := 0; i < 2; i++ {
+		_, _ = c.Info(context.Background())
+	}
+	if atomic.LoadInt32(&failingRequests) == before {
+		t.Fatal("unhealthy endpoint still skipped after Run returned")
+	}
+}
+
+func TestHealthCheckerRules(t *testing.T) {
+	var requests int32
+	server := newInfoServer(`{"result":{"nodes":[{"name":"a","version":"3.1.0","num_clients":5},{"name":"b","version":"3.1.1","num_clients":50}]}}`, &requests)
+	defer server.Close()
+	h := NewHealthChecker(New(Config{Addr: server.URL}), HealthConfig{
+		MinNodes:          3,
+		MaxVersions:       1,
+		MaxClientsPerNode: 10,
+		Rules: []HealthRule{func(InfoResult) error {
+			return errors.New("custom")
+		}},
+	})
+	status := h.Check(context.Background())
+	if status.Healthy || len(status.Endpoints) != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if problems := status.Endpoints[0].Problems; len(problems) != 4 {
+		t.Fatalf("expected 4 problems, got %v", problems)
+	}
+	if h.Status().CheckedAt.IsZero() {
+		t.Fatal("status not cached")
+	}
+}
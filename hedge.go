@@ -0,0 +1,195 @@
+package gocent
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgeConfig configures hedging of read-only requests. Replies of hedged
+// requests are fully buffered in memory before being passed to caller, also
+// when sent with SendPipeStream.
+type HedgeConfig struct {
+	// Delay after which duplicate request is sent to another endpoint if no
+	// response received yet. When Percentile is set Delay is used until
+	// enough latency samples collected.
+	Delay time.Duration
+	// Percentile of latencies of recent read-only requests to use as delay,
+	// for example 0.95. Zero value means using static Delay.
+	Percentile float64
+	// MaxRequests is a maximum number of requests including original one.
+	// Zero value means 2.
+	MaxRequests int
+}
+
+// readOnlyMethods can be safely sent several times.
+var readOnlyMethods = map[string]bool{
+	"presence":       true,
+	"presence_stats": true,
+	"history":        true,
+	"channels":       true,
+	"info":           true,
+}
+
+func isReadOnly(commands []Command) bool {
+	for _, cmd := range commands {
+		if !readOnlyMethods[cmd.Method] {
+			return false
+		}
+	}
+	return true
+}
+
+// minLatencySamples required to use percentile as hedge delay.
+const minLatencySamples = 20
+
+// latencyWindow keeps latencies of recent requests.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [128]time.Duration
+	n       int
+	pos     int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.pos] = d
+	w.pos = (w.pos + 1) % len(w.samples)
+	if w.n < len(w.samples) {
+		w.n++
+	}
+}
+
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	w.mu.Lock()
+	if w.n < minLatencySamples {
+		w.mu.Unlock()
+		return 0, false
+	}
+	samples := make([]time.Duration, w.n)
+	copy(samples, w.samples[:w.n])
+	w.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(p * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i], true
+}
+
+// hedgeDelay returns delay before sending duplicate request.
+func (c *Client) hedgeDelay() time.Duration {
+	if c.hedge.Percentile > 0 {
+		if d, ok := c.latencies.percentile(c.hedge.Percentile); ok {
+			return d
+		}
+	}
+	return c.hedge.Delay
+}
+
+// shouldHedge checks whether commands can be sent with hedging.
+func (c *Client) shouldHedge(commands []Command) bool {
+	return c.hedge != nil && c.getEndpoint == nil && len(c.endpoints) > 1 && isReadOnly(commands)
+}
+
+// hedgeEndpoints returns endpoints in round-robin order starting from next
+// one, so every request of hedged call goes to different endpoint. Unhealthy
+// endpoints are skipped unless all endpoints are unhealthy.
+func (c *Client) hedgeEndpoints() []string {
+	start := atomic.AddUint32(&c.counter, 1) - 1
+	unhealthy := c.health.load()
+	endpoints := make([]string, 0, len(c.endpoints))
+	for i := range c.endpoints {
+		endpoint := c.endpoints[int((start+uint32(i))%uint32(len(c.endpoints)))]
+		if _, skip := unhealthy[endpoint]; !skip {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		for i := range c.endpoints {
+			endpoints = append(endpoints, c.endpoints[int((start+uint32(i))%uint32(len(c.endpoints)))])
+		}
+	}
+	return endpoints
+}
+
+type hedgeResult struct {
+	replies []Reply
+	latency time.Duration
+	err     error
+}
+
+// sendHedged sends request to next endpoint and duplicates it to following
+// endpoints if response not received during hedge delay or request failed.
+// The first successful response is used, other requests are cancelled.
+// Replies are fully buffered since several responses are decoded
+// concurrently. Returns only after all sent requests finished, so body is
+// not released while still read by cancelled requests.
+func (c *Client) sendHedged(ctx context.Context, keys []string, body *requestBody, fn func(i int, rep Reply) error) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	endpoints := c.hedgeEndpoints()
+	maxRequests := c.hedge.MaxRequests
+	if maxRequests <= 0 {
+		maxRequests = 2
+	}
+	if maxRequests > len(endpoints) {
+		maxRequests = len(endpoints)
+	}
+	results := make(chan hedgeResult, maxRequests)
+	var sent, pending int
+	send := func() {
+		endpoint := endpoints[sent]
+		sent++
+		pending++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			var replies []Reply
+			err := c.sendLimited(ctx, endpoint, keys, body, func(_ int, rep Reply) error {
+				replies = append(replies, rep)
+				return nil
+			})
+			results <- hedgeResult{replies: replies, latency: time.Since(start), err: err}
+		}()
+	}
+
+	send()
+	timer := time.NewTimer(c.hedgeDelay())
+	defer timer.Stop()
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if sent < maxRequests {
+				send()
+				timer.Reset(c.hedgeDelay())
+			}
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				lastErr = r.err
+				if pending == 0 && sent < maxRequests && ctx.Err() == nil && isRetryable(r.err) {
+					send()
+				}
+				continue
+			}
+			cancel()
+			c.latencies.add(r.latency)
+			for i, rep := range r.replies {
+				if err := fn(i, rep); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return lastErr
+}
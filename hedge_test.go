@@ -0,0 +1,177 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hedgeServer replies after delay and counts requests per method.
+type hedgeServer struct {
+	delay time.Duration
+
+	mu        sync.Mutex
+	methods   map[string]int
+	cancelled int
+}
+
+func (s *hedgeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	if s.methods == nil {
+		s.methods = map[string]int{}
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		var cmd Command
+		_ = json.Unmarshal(line, &cmd)
+		s.methods[cmd.Method]++
+	}
+	s.mu.Unlock()
+	select {
+	case <-time.After(s.delay):
+	case <-r.Context().Done():
+		s.mu.Lock()
+		s.cancelled++
+		s.mu.Unlock()
+		return
+	}
+	_, _ = w.Write([]byte(strings.Repeat(`{"result":{}}`+"\n", bytes.Count(body, []byte("\n")))))
+}
+
+func (s *hedgeServer) stats() (map[string]int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make(map[string]int, len(s.methods))
+	for k, v := range s.methods {
+		methods[k] = v
+	}
+	return methods, s.cancelled
+}
+
+func TestClientHedging(t *testing.T) {
+	slow := &hedgeServer{delay: 300 * time.Millisecond}
+	fast := &hedgeServer{}
+	slowServer := httptest.NewServer(slow)
+	defer slowServer.Close()
+	fastServer := httptest.NewServer(fast)
+	defer fastServer.Close()
+
+	c := New(Config{
+		Addrs:   []string{slowServer.URL, fastServer.URL},
+		Hedging: &HedgeConfig{Delay: 20 * time.Millisecond},
+		Timeout: time.Second,
+	})
+	// First request goes to slow server and is hedged to fast one.
+	start := time.Now()
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected hedged request to complete fast, took %s", elapsed)
+	}
+	if methods, _ := fast.stats(); methods["info"] != 1 {
+		t.Fatalf("expected hedged request on fast server, got %v", methods)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, cancelled := slow.stats(); cancelled == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slow request not cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Writes never hedged.
+	for i := 0; i < 2; i++ {
+		if _, err := c.Publish(context.Background(), "chat", []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slowMethods, _ := slow.stats()
+	fastMethods, _ := fast.stats()
+	if slowMethods["publish"] != 1 || fastMethods["publish"] != 1 {
+		t.Fatalf("expected one publish per server, got %v and %v", slowMethods, fastMethods)
+	}
+}
+
+// inFlightTransport counts requests which are still in progress.
+type inFlightTransport struct {
+	inFlight int32
+}
+
+func (t *inFlightTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.inFlight, 1)
+	defer atomic.AddInt32(&t.inFlight, -1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClientHedgingWaitsRequests(t *testing.T) {
+	slowServer := httptest.NewServer(&hedgeServer{delay: 300 * time.Millisecond})
+	defer slowServer.Close()
+	fastServer := httptest.NewServer(&hedgeServer{delay: 20 * time.Millisecond})
+	defer fastServer.Close()
+
+	transport := &inFlightTransport{}
+	c := New(Config{
+		Addrs:      []string{slowServer.URL, fastServer.URL, slowServer.URL},
+		Hedging:    &HedgeConfig{Delay: 5 * time.Millisecond, MaxRequests: 3},
+		HTTPClient: &http.Client{Transport: transport, Timeout: time.Second},
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// Request body is released on return, so cancelled requests must
+		// be finished already.
+		if n := atomic.LoadInt32(&transport.inFlight); n != 0 {
+			t.Fatalf("%d requests in flight after reply", n)
+		}
+	}
+}
+
+func TestLatencyWindowPercentile(t *testing.T) {
+	w := &latencyWindow{}
+	for i := 1; i < minLatencySamples; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := w.percentile(0.9); ok {
+		t.Fatal("expected no percentile before enough samples")
+	}
+	for i := minLatencySamples; i <= 200; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	// Window keeps 128 most recent samples: 73ms..200ms.
+	d, ok := w.percentile(0.5)
+	if !ok || d != 137*time.Millisecond {
+		t.Fatalf("unexpected median %s", d)
+	}
+}
+
+func TestHedgeEndpoints(t *testing.T) {
+	c := New(Config{Addrs: []string{"a", "b", "c"}, Hedging: &HedgeConfig{}})
+	for _, expected := range [][]string{{"a", "b", "c"}, {"b", "c", "a"}} {
+		// Every hedged call starts from next endpoint.
+		if endpoints := c.hedgeEndpoints(); !reflect.DeepEqual(endpoints, expected) {
+			t.Fatalf("expected %v, got %v", expected, endpoints)
+		}
+	}
+	c.health.store(map[string]struct{}{"c": {}})
+	if endpoints := c.hedgeEndpoints(); !reflect.DeepEqual(endpoints, []string{"a", "b"}) {
+		t.Fatalf("expected unhealthy endpoint skipped, got %v", endpoints)
+	}
+	c.health.store(map[string]struct{}{"a": {}, "b": {}, "c": {}})
+	if endpoints := c.hedgeEndpoints(); !reflect.DeepEqual(endpoints, []string{"a", "b", "c"}) {
+		t.Fatalf("expected all endpoints used when all unhealthy, got %v", endpoints)
+	}
+}
@@ -0,0 +1,146 @@
+package gocent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errorCodeUnrecoverablePosition is returned by Centrifugo when history requested
+// since position with epoch which does not match current stream epoch.
+const errorCodeUnrecoverablePosition = 112
+
+// ErrEpochChanged returned when channel history stream epoch changed, so
+// publications can't be iterated from previously known position anymore.
+type ErrEpochChanged struct {
+	// Epoch iteration was started with.
+	Epoch string
+	// NewEpoch of stream, may be empty if server did not return it.
+	NewEpoch string
+}
+
+func (e ErrEpochChanged) Error() string {
+	return fmt.Sprintf("stream epoch changed: %q -> %q", e.Epoch, e.NewEpoch)
+}
+
+// defaultHistoryPageSize used by HistoryIterator when page size not set.
+const defaultHistoryPageSize = 100
+
+// HistoryIterator walks over channel history stream page by page.
+//
+//	it := client.HistoryIterator("chat", gocent.WithLimit(100))
+//	for it.Next(ctx) {
+//		pub := it.Publication()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// HistoryIterator is not goroutine-safe.
+type HistoryIterator struct {
+	client   *Client
+	channel  string
+	pageSize int
+	reverse  bool
+	since    *StreamPosition
+	epoch    string
+	page     []Publication
+	current  Publication
+	done     bool
+	err      error
+}
+
+// HistoryIterator returns iterator over channel history. WithLimit sets page
+// size (100 by default), WithSince sets position to start after and WithReverse
+// allows to iterate from newest publications to oldest.
+func (c *Client) HistoryIterator(channel string, opts ...HistoryOption) *HistoryIterator {
+	options := &HistoryOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	pageSize := options.Limit
+	if pageSize <= 0 {
+		pageSize = defaultHistoryPageSize
+	}
+	it := &HistoryIterator{
+		client:   c,
+		channel:  channel,
+		pageSize: pageSize,
+		reverse:  options.Reverse,
+	}
+	if options.Since != nil {
+		since := *options.Since
+		it.since = &since
+		it.epoch = since.Epoch
+	}
+	return it
+}
+
+// Next advances iterator to the next publication loading next history page
+// from server when required. Returns false when iteration is over or error
+// happened – see Err.
+func (it *HistoryIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.fetch(ctx); err != nil {
+			it.err = err
+			return false
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+func (it *HistoryIterator) fetch(ctx context.Context) error {
+	opts := []HistoryOption{WithLimit(it.pageSize), WithReverse(it.reverse)}
+	if it.since != nil {
+		opts = append(opts, WithSince(it.since))
+	}
+	result, err := it.client.History(ctx, it.channel, opts...)
+	if err != nil {
+		var replyErr *Error
+		if errors.As(err, &replyErr) && replyErr.Code == errorCodeUnrecoverablePosition {
+			return ErrEpochChanged{Epoch: it.epoch}
+		}
+		return err
+	}
+	if it.epoch != "" && result.Epoch != it.epoch {
+		return ErrEpochChanged{Epoch: it.epoch, NewEpoch: result.Epoch}
+	}
+	it.epoch = result.Epoch
+	it.page = result.Publications
+	if len(result.Publications) < it.pageSize {
+		it.done = true
+	}
+	if len(result.Publications) > 0 {
+		last := result.Publications[len(result.Publications)-1]
+		it.since = &StreamPosition{Offset: last.Offset, Epoch: result.Epoch}
+	}
+	return nil
+}
+
+// Publication returns current publication.
+func (it *HistoryIterator) Publication() Publication {
+	return it.current
+}
+
+// Position returns stream position of current publication. It may be saved
+// and later passed to WithSince to continue iteration.
+func (it *HistoryIterator) Position() StreamPosition {
+	return StreamPosition{Offset: it.current.Offset, Epoch: it.epoch}
+}
+
+// Err returns error which stopped iteration, nil if iteration finished successfully.
+func (it *HistoryIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,144 @@
+package gocent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// historyServer emulates Centrifugo history stream of one channel.
+type historyServer struct {
+	mu    sync.Mutex
+	epoch string
+	top   uint64
+	// first is the oldest offset still kept in history.
+	first uint64
+}
+
+func (s *historyServer) publish(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.top += uint64(n)
+}
+
+func (s *historyServer) reset(epoch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch = epoch
+	s.top = 0
+	s.first = 0
+}
+
+func (s *historyServer) trim(first uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.first = first
+}
+
+func (s *historyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scanner := bufio.NewScanner(r.Body)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var cmd struct {
+			Params historyRequest `json:"params"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &cmd)
+		p := cmd.Params
+		if p.Since != nil && p.Since.Epoch != s.epoch {
+			_ = enc.Encode(Reply{Error: &Error{Code: errorCodeUnrecoverablePosition, Message: "unrecoverable position"}})
+			continue
+		}
+		var offsets []uint64
+		if p.Reverse {
+			from := s.top
+			if p.Since != nil {
+				from = p.Since.Offset - 1
+			}
+			for o := from; o >= 1 && o >= s.first && len(offsets) < p.Limit; o-- {
+				offsets = append(offsets, o)
+			}
+		} else {
+			var from uint64 = 1
+			if p.Since != nil {
+				from = p.Since.Offset + 1
+			}
+			if from < s.first {
+				from = s.first
+			}
+			for o := from; o <= s.top && len(offsets) < p.Limit; o++ {
+				offsets = append(offsets, o)
+			}
+		}
+		result := HistoryResult{Offset: s.top, Epoch: s.epoch}
+		for _, o := range offsets {
+			result.Publications = append(result.Publications, Publication{Offset: o, Data: json.RawMessage(strconv.FormatUint(o, 10))})
+		}
+		data, _ := json.Marshal(result)
+		_ = enc.Encode(Reply{Result: data})
+	}
+}
+
+func TestHistoryIterator(t *testing.T) {
+	srv := &historyServer{epoch: "a"}
+	srv.publish(25)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := New(Config{Addr: ts.URL})
+	ctx := context.Background()
+
+	it := c.HistoryIterator("test", WithLimit(10))
+	var expected uint64 = 1
+	for it.Next(ctx) {
+		if it.Publication().Offset != expected {
+			t.Fatalf("expected offset %d, got %d", expected, it.Publication().Offset)
+		}
+		expected++
+	}
+	if it.Err() != nil || expected != 26 {
+		t.Fatalf("unexpected iteration end: %v, %d", it.Err(), expected)
+	}
+
+	it = c.HistoryIterator("test", WithLimit(10), WithReverse(true), WithSince(&StreamPosition{Offset: 20, Epoch: "a"}))
+	expected = 19
+	for it.Next(ctx) {
+		if it.Publication().Offset != expected {
+			t.Fatalf("expected offset %d, got %d", expected, it.Publication().Offset)
+		}
+		expected--
+	}
+	if it.Err() != nil || expected != 0 {
+		t.Fatalf("unexpected iteration end: %v, %d", it.Err(), expected)
+	}
+}
+
+func TestHistoryIteratorEpochChanged(t *testing.T) {
+	srv := &historyServer{epoch: "a"}
+	srv.publish(15)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := New(Config{Addr: ts.URL})
+	ctx := context.Background()
+
+	it := c.HistoryIterator("test", WithLimit(10))
+	for i := 0; i < 10; i++ {
+		if !it.Next(ctx) {
+			t.Fatal("expected publication")
+		}
+	}
+	srv.reset("b")
+	if it.Next(ctx) {
+		t.Fatal("expected iteration to stop")
+	}
+	var epochErr ErrEpochChanged
+	if !errors.As(it.Err(), &epochErr) || epochErr.Epoch != "a" {
+		t.Fatalf("expected ErrEpochChanged, got %v", it.Err())
+	}
+}
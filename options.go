@@ -4,6 +4,9 @@ import "encoding/json"
 
 type PublishOptions struct {
 	SkipHistory bool `json:"skip_history,omitempty"`
+	// IdempotencyKey allows Centrifugo to drop duplicate publications sent
+	// with the same key during a short period of time.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 // PublishOption is a type to represent various Publish options.
@@ -16,6 +19,13 @@ func WithSkipHistory(skip bool) PublishOption {
 	}
 }
 
+// WithIdempotencyKey allows to set IdempotencyKey field.
+func WithIdempotencyKey(key string) PublishOption {
+	return func(opts *PublishOptions) {
+		opts.IdempotencyKey = key
+	}
+}
+
 // SubscribeOptions define per-subscription options.
 type SubscribeOptions struct {
 	// ChannelInfo defines custom channel information, zero value means no channel information.
@@ -0,0 +1,185 @@
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+const (
+	segmentExt     = ".log"
+	checkpointName = "checkpoint"
+	recordHeader   = 8
+	maxRecordSize  = 64 << 20
+)
+
+// errCorrupted returned when record in segment can not be decoded.
+var errCorrupted = errors.New("corrupted record")
+
+// position points to a record inside the segment log.
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type segment struct {
+	id   uint64
+	path string
+	// size is a number of bytes fully written (and synced if required) into segment.
+	size int64
+}
+
+// record is a single command read from segment log.
+type record struct {
+	cmd  gocent.Command
+	next position
+}
+
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// listSegments returns segments found in dir sorted by id.
+func listSegments(dir string) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, &segment{id: id, path: filepath.Join(dir, name), size: info.Size()})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].id < segments[j].id })
+	return segments, nil
+}
+
+// recoverSegment scans segment and truncates a torn or corrupted tail left
+// after a crash in the middle of write.
+func recoverSegment(s *segment) error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	var offset int64
+	for offset < s.size {
+		_, n, err := readRecord(f, offset)
+		if err != nil {
+			break
+		}
+		offset += n
+	}
+	if offset == s.size {
+		return nil
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	s.size = offset
+	return f.Sync()
+}
+
+func encodeRecord(cmd gocent.Command) ([]byte, error) {
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("command too large: %d bytes", len(payload))
+	}
+	buf := make([]byte, recordHeader+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeader:], payload)
+	return buf, nil
+}
+
+// readRecord reads one record at offset and returns decoded command and number
+// of bytes the record occupies in segment.
+func readRecord(r io.ReaderAt, offset int64) (gocent.Command, int64, error) {
+	var header [recordHeader]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return gocent.Command{}, 0, errCorrupted
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return gocent.Command{}, 0, errCorrupted
+	}
+	payload := make([]byte, size)
+	if _, err := r.ReadAt(payload, offset+recordHeader); err != nil {
+		return gocent.Command{}, 0, errCorrupted
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return gocent.Command{}, 0, errCorrupted
+	}
+	var raw struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return gocent.Command{}, 0, errCorrupted
+	}
+	return gocent.Command{Method: raw.Method, Params: raw.Params}, recordHeader + int64(size), nil
+}
+
+func readCheckpoint(dir string) (position, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return position{}, false, nil
+		}
+		return position{}, false, err
+	}
+	var pos position
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return position{}, false, fmt.Errorf("malformed checkpoint: %w", err)
+	}
+	return pos, true, nil
+}
+
+// writeCheckpoint atomically replaces checkpoint file.
+func writeCheckpoint(dir string, pos position) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, checkpointName+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, checkpointName))
+}
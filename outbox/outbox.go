@@ -0,0 +1,473 @@
+// Package outbox provides durable asynchronous delivery of publications to
+// Centrifugo. Commands are first appended to a local write-ahead log and then
+// sent to server in the background, so they survive Centrifugo unavailability
+// and process restarts.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+var (
+	// ErrClosed returned when Outbox already closed.
+	ErrClosed = errors.New("outbox closed")
+)
+
+// DeliveryError passed to Config.ErrorHandler when Centrifugo rejected a
+// command with reply error. Such commands are not retried.
+type DeliveryError struct {
+	Command gocent.Command
+	Err     *gocent.Error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%s command rejected: %v", e.Command.Method, e.Err)
+}
+
+// Config of Outbox.
+type Config struct {
+	// Dir is a directory to keep segment log in. Created if not exists.
+	Dir string
+	// Client to deliver commands with.
+	Client *gocent.Client
+	// SegmentSize is a size of segment file in bytes after which new segment
+	// will be started. Zero value means 4MB.
+	SegmentSize int64
+	// BatchSize is a maximum number of commands to send in one Pipe.
+	// Zero value means 100.
+	BatchSize int
+	// MinRetryDelay is a delay before first retry of failed Pipe. Zero value means 100ms.
+	MinRetryDelay time.Duration
+	// MaxRetryDelay is a maximum delay between retries. Zero value means 10s.
+	MaxRetryDelay time.Duration
+	// NoSync disables fsync after every append. This makes appends much faster
+	// but commands appended right before machine crash may be lost.
+	NoSync bool
+	// ErrorHandler is called on every delivery error. Optional. Called from
+	// delivery goroutine without locks held, so it may call Publish, but
+	// Flush called from it waits until its context done.
+	ErrorHandler func(error)
+}
+
+// Outbox appends publish and broadcast commands to a segment log on disk and
+// delivers them to Centrifugo with retries. Commands are delivered in the order
+// they were appended (thus per-channel order preserved) with at-least-once
+// guarantee: the same Pipe may be sent again after a network error.
+type Outbox struct {
+	config   Config
+	mu       sync.Mutex
+	segments []*segment
+	active   *os.File
+	acked    position
+	closed   bool
+	appended chan struct{}
+	ackCh    chan struct{}
+	closeCh  chan struct{}
+	doneCh   chan struct{}
+	cancel   context.CancelFunc
+}
+
+// New opens Outbox in Config.Dir and starts delivering commands left there
+// from previous runs.
+func New(c Config) (*Outbox, error) {
+	if c.Dir == "" {
+		return nil, errors.New("outbox: Dir required")
+	}
+	if c.Client == nil {
+		return nil, errors.New("outbox: Client required")
+	}
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = 4 << 20
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.MinRetryDelay <= 0 {
+		c.MinRetryDelay = 100 * time.Millisecond
+	}
+	if c.MaxRetryDelay <= 0 {
+		c.MaxRetryDelay = 10 * time.Second
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	acked, ok, err := readCheckpoint(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		s := &segment{id: acked.Segment, path: segmentPath(c.Dir, acked.Segment)}
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+		syncDir(c.Dir)
+		segments = append(segments, s)
+		acked = position{Segment: s.id}
+	} else if err := recoverSegment(segments[len(segments)-1]); err != nil {
+		return nil, err
+	}
+	if !ok || acked.Segment < segments[0].id {
+		acked = position{Segment: segments[0].id}
+	}
+	// Remove segments fully acknowledged before restart.
+	for len(segments) > 1 && segments[0].id < acked.Segment {
+		if err := os.Remove(segments[0].path); err != nil {
+			return nil, err
+		}
+		segments = segments[1:]
+	}
+	last := segments[len(segments)-1]
+	active, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Outbox{
+		config:   c,
+		segments: segments,
+		active:   active,
+		acked:    acked,
+		appended: make(chan struct{}, 1),
+		ackCh:    make(chan struct{}),
+		closeCh:  make(chan struct{}),
+		doneCh:   make(chan struct{}),
+		cancel:   cancel,
+	}
+	go o.run(ctx)
+	return o, nil
+}
+
+// Publish durably appends publish command to Outbox. Command will be sent to
+// Centrifugo asynchronously.
+func (o *Outbox) Publish(channel string, data []byte, opts ...gocent.PublishOption) error {
+	pipe := o.config.Client.Pipe()
+	if err := pipe.AddPublish(channel, data, opts...); err != nil {
+		return err
+	}
+	return o.append(pipe.Commands()[0])
+}
+
+// Broadcast durably appends broadcast command to Outbox. Command will be sent to
+// Centrifugo asynchronously.
+func (o *Outbox) Broadcast(channels []string, data []byte, opts ...gocent.PublishOption) error {
+	pipe := o.config.Client.Pipe()
+	if err := pipe.AddBroadcast(channels, data, opts...); err != nil {
+		return err
+	}
+	return o.append(pipe.Commands()[0])
+}
+
+// Flush blocks until all commands appended so far are delivered or context done.
+func (o *Outbox) Flush(ctx context.Context) error {
+	for {
+		o.mu.Lock()
+		empty := o.emptyLocked()
+		ch := o.ackCh
+		o.mu.Unlock()
+		if empty {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-o.doneCh:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops delivery. Undelivered commands stay on disk and will be sent
+// after Outbox with the same Dir opened again.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+	close(o.closeCh)
+	o.cancel()
+	<-o.doneCh
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.active.Close()
+}
+
+func (o *Outbox) append(cmd gocent.Command) error {
+	data, err := encodeRecord(cmd)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	last := o.segments[len(o.segments)-1]
+	if last.size > 0 && last.size+int64(len(data)) > o.config.SegmentSize {
+		if err := o.rotateLocked(); err != nil {
+			return err
+		}
+		last = o.segments[len(o.segments)-1]
+	}
+	if _, err := o.active.Write(data); err != nil {
+		// Drop partially written record so it won't be seen as corruption later.
+		_ = o.active.Truncate(last.size)
+		return err
+	}
+	if !o.config.NoSync {
+		if err := o.active.Sync(); err != nil {
+			_ = o.active.Truncate(last.size)
+			return err
+		}
+	}
+	last.size += int64(len(data))
+	select {
+	case o.appended <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *Outbox) rotateLocked() error {
+	if err := o.active.Sync(); err != nil {
+		return err
+	}
+	id := o.segments[len(o.segments)-1].id + 1
+	s := &segment{id: id, path: segmentPath(o.config.Dir, id)}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	syncDir(o.config.Dir)
+	_ = o.active.Close()
+	o.active = f
+	o.segments = append(o.segments, s)
+	return nil
+}
+
+func (o *Outbox) emptyLocked() bool {
+	for _, s := range o.segments {
+		if s.id < o.acked.Segment {
+			continue
+		}
+		if s.id == o.acked.Segment {
+			if s.size > o.acked.Offset {
+				return false
+			}
+			continue
+		}
+		if s.size > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Outbox) run(ctx context.Context) {
+	defer close(o.doneCh)
+	for {
+		records, err := o.read(o.config.BatchSize)
+		if len(records) > 0 {
+			if !o.deliver(ctx, records) {
+				return
+			}
+			o.ack(records[len(records)-1].next)
+		}
+		var corrupted *corruptedError
+		if errors.As(err, &corrupted) {
+			// Nothing can be done with broken data, skip the rest of segment.
+			o.handleError(err)
+			o.ack(corrupted.skipTo)
+			continue
+		} else if err != nil {
+			o.handleError(err)
+			if !o.sleep(o.config.MinRetryDelay) {
+				return
+			}
+			continue
+		}
+		if len(records) > 0 {
+			continue
+		}
+		select {
+		case <-o.appended:
+		case <-o.closeCh:
+			return
+		}
+	}
+}
+
+type corruptedError struct {
+	segment uint64
+	offset  int64
+	skipTo  position
+}
+
+func (e *corruptedError) Error() string {
+	return fmt.Sprintf("outbox: corrupted record in segment %d at offset %d", e.segment, e.offset)
+}
+
+// read reads up to limit records after acknowledged position.
+func (o *Outbox) read(limit int) ([]record, error) {
+	o.mu.Lock()
+	pos := o.acked
+	segments := make([]segment, 0, len(o.segments))
+	for _, s := range o.segments {
+		segments = append(segments, *s)
+	}
+	o.mu.Unlock()
+
+	var records []record
+	for _, s := range segments {
+		if s.id < pos.Segment {
+			continue
+		}
+		if s.id > pos.Segment {
+			pos = position{Segment: s.id}
+		}
+		if pos.Offset >= s.size {
+			continue
+		}
+		f, err := os.Open(s.path)
+		if err != nil {
+			return records, err
+		}
+		for pos.Offset < s.size && len(records) < limit {
+			cmd, n, err := readRecord(f, pos.Offset)
+			if err != nil {
+				_ = f.Close()
+				return records, &corruptedError{
+					segment: s.id,
+					offset:  pos.Offset,
+					skipTo:  position{Segment: s.id, Offset: s.size},
+				}
+			}
+			pos.Offset += n
+			records = append(records, record{cmd: cmd, next: pos})
+		}
+		_ = f.Close()
+		if len(records) >= limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+// deliver sends records to Centrifugo retrying until success. Returns false
+// if Outbox was closed before records were delivered.
+func (o *Outbox) deliver(ctx context.Context, records []record) bool {
+	pipe := o.config.Client.Pipe()
+	for _, r := range records {
+		_ = pipe.AddCommand(r.cmd)
+	}
+	delay := o.config.MinRetryDelay
+	for {
+		replies, err := o.config.Client.SendPipe(ctx, pipe)
+		if err == nil {
+			for i, reply := range replies {
+				if reply.Error != nil {
+					o.handleError(&DeliveryError{Command: records[i].cmd, Err: reply.Error})
+				}
+			}
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		o.handleError(err)
+		if !o.sleep(delay) {
+			return false
+		}
+		delay *= 2
+		if delay > o.config.MaxRetryDelay {
+			delay = o.config.MaxRetryDelay
+		}
+	}
+}
+
+// ack moves acknowledged position forward and removes segments which are
+// not needed anymore.
+func (o *Outbox) ack(pos position) {
+	// Errors handled after unlock, so ErrorHandler may call Outbox methods.
+	for _, err := range o.ackLocked(pos) {
+		o.handleError(err)
+	}
+}
+
+func (o *Outbox) ackLocked(pos position) []error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Move to next segment start if current one fully consumed and sealed.
+	for i := 0; i < len(o.segments)-1; i++ {
+		s := o.segments[i]
+		if s.id < pos.Segment {
+			continue
+		}
+		if s.id > pos.Segment || pos.Offset < s.size {
+			break
+		}
+		pos = position{Segment: o.segments[i+1].id}
+	}
+	var errs []error
+	// Position moved forward in memory even if checkpoint not saved, so
+	// commands are not delivered again until restart. Segments are kept
+	// then to redeliver commands after restart.
+	if err := writeCheckpoint(o.config.Dir, pos); err != nil {
+		errs = append(errs, err)
+	}
+	for len(errs) == 0 && len(o.segments) > 1 && o.segments[0].id < pos.Segment {
+		if err := os.Remove(o.segments[0].path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			break
+		}
+		o.segments = o.segments[1:]
+	}
+	o.acked = pos
+	close(o.ackCh)
+	o.ackCh = make(chan struct{})
+	return errs
+}
+
+func (o *Outbox) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-o.closeCh:
+		return false
+	}
+}
+
+func (o *Outbox) handleError(err error) {
+	if o.config.ErrorHandler != nil {
+		o.config.ErrorHandler(err)
+	}
+}
+
+// syncDir makes directory entries changes durable. Not supported on some
+// platforms so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,211 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+type fakeServer struct {
+	mu        sync.Mutex
+	available bool
+	received  []string
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.available {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var cmd struct {
+			Params struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"params"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &cmd)
+		s.received = append(s.received, string(cmd.Params.Data))
+		_, _ = w.Write([]byte(`{"result":{}}` + "\n"))
+	}
+}
+
+func (s *fakeServer) setAvailable(available bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.available = available
+}
+
+func (s *fakeServer) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+func newTestOutbox(t *testing.T, dir string, addr string) *Outbox {
+	o, err := New(Config{
+		Dir:           dir,
+		Client:        gocent.New(gocent.Config{Addr: addr}),
+		SegmentSize:   256,
+		BatchSize:     3,
+		MinRetryDelay: time.Millisecond,
+		MaxRetryDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	srv := &fakeServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+
+	o := newTestOutbox(t, dir, ts.URL)
+	for i := 0; i < 20; i++ {
+		if err := o.Publish("test", []byte(fmt.Sprintf(`%d`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.messages()) != 0 {
+		t.Fatal("unexpected delivery to unavailable server")
+	}
+
+	srv.setAvailable(true)
+	o = newTestOutbox(t, dir, ts.URL)
+	defer func() { _ = o.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	messages := srv.messages()
+	if len(messages) != 20 {
+		t.Fatalf("expected 20 messages, got %d", len(messages))
+	}
+	for i, m := range messages {
+		if m != fmt.Sprintf(`%d`, i) {
+			t.Fatalf("unexpected message order: %v", messages)
+		}
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("expected acknowledged segments to be removed, got %d segments", len(segments))
+	}
+}
+
+func TestOutboxTornTail(t *testing.T) {
+	srv := &fakeServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+
+	o := newTestOutbox(t, dir, ts.URL)
+	if err := o.Publish("test", []byte(`1`)); err != nil {
+		t.Fatal(err)
+	}
+	_ = o.Close()
+
+	// Simulate crash in the middle of record write.
+	segments, _ := listSegments(dir)
+	f, err := os.OpenFile(segments[len(segments)-1].path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 1})
+	_ = f.Close()
+
+	srv.setAvailable(true)
+	o = newTestOutbox(t, dir, ts.URL)
+	defer func() { _ = o.Close() }()
+	if err := o.Publish("test", []byte(`2`)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	messages := srv.messages()
+	if len(messages) != 2 || messages[0] != `1` || messages[1] != `2` {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointName)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxErrorHandlerPublish(t *testing.T) {
+	srv := &fakeServer{available: true}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir := t.TempDir()
+	// Directory in place of temporary checkpoint file makes ack fail.
+	if err := os.Mkdir(filepath.Join(dir, checkpointName+".tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var o *Outbox
+	handled := make(chan error, 1)
+	var once sync.Once
+	o, err := New(Config{
+		Dir:           dir,
+		Client:        gocent.New(gocent.Config{Addr: ts.URL}),
+		MinRetryDelay: time.Millisecond,
+		ErrorHandler: func(error) {
+			once.Do(func() {
+				handled <- o.Publish("test", []byte(`2`))
+			})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = o.Close() }()
+	if err := o.Publish("test", []byte(`1`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-handled:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ErrorHandler calling Publish deadlocked")
+	}
+
+	// Commands delivered once while checkpoint can't be saved.
+	if err := o.Publish("test", []byte(`3`)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := srv.messages(); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("expected every message published once, got %v", got)
+	}
+}
@@ -0,0 +1,390 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+// QuestionPlaceholder formats bind parameters as ? (SQLite, MySQL).
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder formats bind parameters as $1, $2... (PostgreSQL).
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLConfig of SQLOutbox.
+//
+// Outbox table must be created in advance and have the following columns
+// (example for SQLite, adapt types for your database):
+//
+//	CREATE TABLE gocent_outbox (
+//		id INTEGER PRIMARY KEY AUTOINCREMENT,
+//		idempotency_key TEXT NOT NULL UNIQUE,
+//		method TEXT NOT NULL,
+//		params TEXT NOT NULL,
+//		created_at BIGINT NOT NULL,
+//		locked_until BIGINT NOT NULL DEFAULT 0,
+//		lock_owner TEXT NOT NULL DEFAULT '',
+//		attempts INTEGER NOT NULL DEFAULT 0,
+//		delivered_at BIGINT NOT NULL DEFAULT 0
+//	);
+//
+// All time values are stored as Unix nanoseconds.
+type SQLConfig struct {
+	// DB is used by relay to poll and update outbox rows.
+	DB *sql.DB
+	// Client to deliver commands with.
+	Client *gocent.Client
+	// Table is outbox table name. Zero value means gocent_outbox.
+	Table string
+	// Placeholder formats n-th (starting from 1) bind parameter.
+	// Zero value means QuestionPlaceholder.
+	Placeholder func(n int) string
+	// BatchSize is a maximum number of rows sent in one Pipe. Zero value means 100.
+	BatchSize int
+	// PollInterval is a delay between polls when there are no pending rows.
+	// Zero value means 1s.
+	PollInterval time.Duration
+	// LeaseDuration is a time rows stay locked by relay worker. After lease
+	// expires rows may be picked by another worker. Zero value means 30s.
+	LeaseDuration time.Duration
+	// RetryDelay is a time after which rows will be retried upon send error.
+	// Zero value means 1s.
+	RetryDelay time.Duration
+	// SkipLocked adds FOR UPDATE SKIP LOCKED to the rows selection query so
+	// concurrent relay workers do not contend on the same rows. Only use it
+	// with databases which support this clause.
+	SkipLocked bool
+	// DeleteDelivered removes rows after delivery instead of setting delivered_at.
+	DeleteDelivered bool
+	// Owner identifies relay worker in lock_owner column. Random by default.
+	Owner string
+	// ErrorHandler is called on every relay error. Optional.
+	ErrorHandler func(error)
+}
+
+// SQLOutbox stores commands in database table inside caller transaction, so
+// publications become visible to relay only after transaction commit. Relay
+// then sends them to Centrifugo. Publish and broadcast commands are sent with
+// idempotency key so Centrifugo drops duplicates caused by relay retries.
+//
+// Commands are relayed in table insertion order as long as one relay worker
+// running. Several concurrent workers only preserve order inside a batch.
+type SQLOutbox struct {
+	config SQLConfig
+	// now returns current time, replaced in tests.
+	now func() time.Time
+}
+
+// NewSQL creates SQLOutbox.
+func NewSQL(c SQLConfig) (*SQLOutbox, error) {
+	if c.DB == nil {
+		return nil, errors.New("outbox: DB required")
+	}
+	if c.Client == nil {
+		return nil, errors.New("outbox: Client required")
+	}
+	if c.Table == "" {
+		c.Table = "gocent_outbox"
+	}
+	if c.Placeholder == nil {
+		c.Placeholder = QuestionPlaceholder
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.LeaseDuration <= 0 {
+		c.LeaseDuration = 30 * time.Second
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	if c.Owner == "" {
+		owner, err := randomKey()
+		if err != nil {
+			return nil, err
+		}
+		c.Owner = owner
+	}
+	return &SQLOutbox{config: c, now: time.Now}, nil
+}
+
+// Publish stores publish command in transaction. Idempotency key generated
+// automatically unless set with gocent.WithIdempotencyKey.
+func (o *SQLOutbox) Publish(ctx context.Context, tx *sql.Tx, channel string, data []byte, opts ...gocent.PublishOption) error {
+	key, opts, err := idempotencyKey(opts)
+	if err != nil {
+		return err
+	}
+	pipe := o.config.Client.Pipe()
+	if err := pipe.AddPublish(channel, data, opts...); err != nil {
+		return err
+	}
+	return o.insert(ctx, tx, key, pipe.Commands()[0])
+}
+
+// Broadcast stores broadcast command in transaction. Idempotency key generated
+// automatically unless set with gocent.WithIdempotencyKey.
+func (o *SQLOutbox) Broadcast(ctx context.Context, tx *sql.Tx, channels []string, data []byte, opts ...gocent.PublishOption) error {
+	key, opts, err := idempotencyKey(opts)
+	if err != nil {
+		return err
+	}
+	pipe := o.config.Client.Pipe()
+	if err := pipe.AddBroadcast(channels, data, opts...); err != nil {
+		return err
+	}
+	return o.insert(ctx, tx, key, pipe.Commands()[0])
+}
+
+// Add stores arbitrary command in transaction. Key must be unique among
+// outbox rows, empty key means random one.
+func (o *SQLOutbox) Add(ctx context.Context, tx *sql.Tx, key string, cmd gocent.Command) error {
+	if key == "" {
+		k, err := randomKey()
+		if err != nil {
+			return err
+		}
+		key = k
+	}
+	return o.insert(ctx, tx, key, cmd)
+}
+
+func (o *SQLOutbox) insert(ctx context.Context, tx *sql.Tx, key string, cmd gocent.Command) error {
+	params, err := json.Marshal(cmd.Params)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (idempotency_key, method, params, created_at) VALUES (%s, %s, %s, %s)",
+		o.config.Table, o.ph(1), o.ph(2), o.ph(3), o.ph(4),
+	)
+	_, err = tx.ExecContext(ctx, query, key, cmd.Method, string(params), o.now().UnixNano())
+	return err
+}
+
+// Relay polls outbox table and sends pending rows to Centrifugo until
+// context canceled. Always returns non-nil error.
+func (o *SQLOutbox) Relay(ctx context.Context) error {
+	for {
+		n, err := o.RelayOnce(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			o.handleError(err)
+		}
+		if n == o.config.BatchSize && err == nil {
+			continue
+		}
+		timer := time.NewTimer(o.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type outboxRow struct {
+	id  int64
+	cmd gocent.Command
+}
+
+// RelayOnce claims one batch of pending rows, sends them in one Pipe and marks
+// delivered. Returns number of delivered rows.
+func (o *SQLOutbox) RelayOnce(ctx context.Context) (int, error) {
+	rows, err := o.claim(ctx)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	pipe := o.config.Client.Pipe()
+	ids := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		_ = pipe.AddCommand(r.cmd)
+		ids = append(ids, r.id)
+	}
+	replies, err := o.config.Client.SendPipe(ctx, pipe)
+	if err != nil {
+		retryAt := o.now().Add(o.config.RetryDelay).UnixNano()
+		query := fmt.Sprintf(
+			"UPDATE %s SET locked_until = %s, attempts = attempts + 1 WHERE lock_owner = %s AND id IN (%s)",
+			o.config.Table, o.ph(1), o.ph(2), o.phList(3, len(ids)),
+		)
+		if _, releaseErr := o.config.DB.ExecContext(ctx, query, append([]interface{}{retryAt, o.config.Owner}, int64Args(ids)...)...); releaseErr != nil {
+			o.handleError(releaseErr)
+		}
+		return 0, err
+	}
+	for i, reply := range replies {
+		if reply.Error != nil {
+			o.handleError(&DeliveryError{Command: rows[i].cmd, Err: reply.Error})
+		}
+	}
+	var query string
+	var args []interface{}
+	if o.config.DeleteDelivered {
+		query = fmt.Sprintf(
+			"DELETE FROM %s WHERE lock_owner = %s AND id IN (%s)",
+			o.config.Table, o.ph(1), o.phList(2, len(ids)),
+		)
+		args = append([]interface{}{o.config.Owner}, int64Args(ids)...)
+	} else {
+		query = fmt.Sprintf(
+			"UPDATE %s SET delivered_at = %s, attempts = attempts + 1 WHERE lock_owner = %s AND id IN (%s)",
+			o.config.Table, o.ph(1), o.ph(2), o.phList(3, len(ids)),
+		)
+		args = append([]interface{}{o.now().UnixNano(), o.config.Owner}, int64Args(ids)...)
+	}
+	if _, err := o.config.DB.ExecContext(ctx, query, args...); err != nil {
+		// Rows will be sent again after lease expiration, idempotency
+		// key protects from duplicates.
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// claim locks batch of pending rows for this relay worker.
+func (o *SQLOutbox) claim(ctx context.Context) ([]outboxRow, error) {
+	now := o.now()
+	lockedUntil := now.Add(o.config.LeaseDuration).UnixNano()
+
+	tx, err := o.config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := fmt.Sprintf(
+		"SELECT id FROM %s WHERE delivered_at = 0 AND locked_until < %s ORDER BY id LIMIT %d",
+		o.config.Table, o.ph(1), o.config.BatchSize,
+	)
+	if o.config.SkipLocked {
+		query += " FOR UPDATE SKIP LOCKED"
+	}
+	ids, err := queryIDs(ctx, tx, query, now.UnixNano())
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	query = fmt.Sprintf(
+		"UPDATE %s SET lock_owner = %s, locked_until = %s WHERE delivered_at = 0 AND locked_until < %s AND id IN (%s)",
+		o.config.Table, o.ph(1), o.ph(2), o.ph(3), o.phList(4, len(ids)),
+	)
+	args := append([]interface{}{o.config.Owner, lockedUntil, now.UnixNano()}, int64Args(ids)...)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+	// Other workers could claim some of selected rows in between, so only
+	// take rows locked by this claim.
+	query = fmt.Sprintf(
+		"SELECT id, method, params FROM %s WHERE lock_owner = %s AND locked_until = %s AND delivered_at = 0 ORDER BY id",
+		o.config.Table, o.ph(1), o.ph(2),
+	)
+	rows, err := tx.QueryContext(ctx, query, o.config.Owner, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var result []outboxRow
+	for rows.Next() {
+		var r outboxRow
+		var params string
+		if err := rows.Scan(&r.id, &r.cmd.Method, &params); err != nil {
+			return nil, err
+		}
+		r.cmd.Params = json.RawMessage(params)
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (o *SQLOutbox) ph(n int) string {
+	return o.config.Placeholder(n)
+}
+
+// phList returns count comma-separated placeholders starting from n-th.
+func (o *SQLOutbox) phList(n int, count int) string {
+	placeholders := make([]string, count)
+	for i := range placeholders {
+		placeholders[i] = o.ph(n + i)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+func (o *SQLOutbox) handleError(err error) {
+	if o.config.ErrorHandler != nil {
+		o.config.ErrorHandler(err)
+	}
+}
+
+func int64Args(values []int64) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// idempotencyKey extracts idempotency key from options or generates a new one.
+func idempotencyKey(opts []gocent.PublishOption) (string, []gocent.PublishOption, error) {
+	options := &gocent.PublishOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.IdempotencyKey != "" {
+		return options.IdempotencyKey, opts, nil
+	}
+	key, err := randomKey()
+	if err != nil {
+		return "", nil, err
+	}
+	return key, append(opts[:len(opts):len(opts)], gocent.WithIdempotencyKey(key)), nil
+}
+
+func randomKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,392 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/centrifugal/gocent/v3"
+)
+
+// memDriver is a tiny database/sql driver which understands only queries
+// issued by SQLOutbox with default config, other queries and arguments of
+// unexpected types are rejected. It keeps outbox rows in memory.
+type memDriver struct {
+	mu     sync.Mutex
+	nextID int64
+	rows   map[int64]*memRow
+}
+
+type memRow struct {
+	key         string
+	method      string
+	params      string
+	lockedUntil int64
+	lockOwner   string
+	attempts    int64
+	deliveredAt int64
+}
+
+func (d *memDriver) Open(string) (driver.Conn, error) {
+	return &memConn{d: d}, nil
+}
+
+type memConn struct {
+	d       *memDriver
+	pending []*memRow
+	inTx    bool
+}
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) {
+	return &memStmt{c: c, query: query}, nil
+}
+
+func (c *memConn) Close() error { return nil }
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *memConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	for _, r := range c.pending {
+		for _, existing := range c.d.rows {
+			if existing.key == r.key {
+				return errors.New("unique constraint failed")
+			}
+		}
+		c.d.nextID++
+		c.d.rows[c.d.nextID] = r
+	}
+	c.pending = nil
+	c.inTx = false
+	return nil
+}
+
+func (c *memConn) Rollback() error {
+	c.pending = nil
+	c.inTx = false
+	return nil
+}
+
+type memStmt struct {
+	c     *memConn
+	query string
+}
+
+func (s *memStmt) Close() error  { return nil }
+func (s *memStmt) NumInput() int { return -1 }
+
+// placeholders returns n comma-separated question placeholders.
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// checkArgs verifies number and types of arguments, kinds contain s for
+// string and i for int64 argument, kind followed by * matches one or more
+// trailing arguments.
+func checkArgs(query string, args []driver.Value, kinds string) error {
+	repeat := strings.HasSuffix(kinds, "*")
+	kinds = strings.TrimSuffix(kinds, "*")
+	if len(args) < len(kinds) || (!repeat && len(args) != len(kinds)) {
+		return fmt.Errorf("unexpected number of arguments %d for query: %s", len(args), query)
+	}
+	for i, arg := range args {
+		kind := kinds[len(kinds)-1]
+		if i < len(kinds) {
+			kind = kinds[i]
+		}
+		var ok bool
+		switch kind {
+		case 's':
+			_, ok = arg.(string)
+		case 'i':
+			_, ok = arg.(int64)
+		}
+		if !ok {
+			return fmt.Errorf("unexpected argument %d %#v for query: %s", i+1, arg, query)
+		}
+	}
+	return nil
+}
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.c.d
+	n := len(args)
+	switch s.query {
+	case "INSERT INTO gocent_outbox (idempotency_key, method, params, created_at) VALUES (?, ?, ?, ?)":
+		if err := checkArgs(s.query, args, "sssi"); err != nil {
+			return nil, err
+		}
+		r := &memRow{key: args[0].(string), method: args[1].(string), params: args[2].(string)}
+		if s.c.inTx {
+			s.c.pending = append(s.c.pending, r)
+			return driver.RowsAffected(1), nil
+		}
+		s.c.pending = []*memRow{r}
+		return driver.RowsAffected(1), s.c.Commit()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var affected int64
+	switch s.query {
+	case "UPDATE gocent_outbox SET lock_owner = ?, locked_until = ? WHERE delivered_at = 0 AND locked_until < ? AND id IN (" + placeholders(n-3) + ")":
+		if err := checkArgs(s.query, args, "siii*"); err != nil {
+			return nil, err
+		}
+		for _, id := range args[3:] {
+			r := d.rows[id.(int64)]
+			if r != nil && r.deliveredAt == 0 && r.lockedUntil < args[2].(int64) {
+				r.lockOwner, r.lockedUntil = args[0].(string), args[1].(int64)
+				affected++
+			}
+		}
+	case "UPDATE gocent_outbox SET locked_until = ?, attempts = attempts + 1 WHERE lock_owner = ? AND id IN (" + placeholders(n-2) + ")":
+		if err := checkArgs(s.query, args, "isi*"); err != nil {
+			return nil, err
+		}
+		for _, id := range args[2:] {
+			if r := d.rows[id.(int64)]; r != nil && r.lockOwner == args[1].(string) {
+				r.lockedUntil = args[0].(int64)
+				r.attempts++
+				affected++
+			}
+		}
+	case "UPDATE gocent_outbox SET delivered_at = ?, attempts = attempts + 1 WHERE lock_owner = ? AND id IN (" + placeholders(n-2) + ")":
+		if err := checkArgs(s.query, args, "isi*"); err != nil {
+			return nil, err
+		}
+		for _, id := range args[2:] {
+			if r := d.rows[id.(int64)]; r != nil && r.lockOwner == args[1].(string) {
+				r.deliveredAt = args[0].(int64)
+				r.attempts++
+				affected++
+			}
+		}
+	case "DELETE FROM gocent_outbox WHERE lock_owner = ? AND id IN (" + placeholders(n-1) + ")":
+		if err := checkArgs(s.query, args, "si*"); err != nil {
+			return nil, err
+		}
+		for _, id := range args[1:] {
+			if r := d.rows[id.(int64)]; r != nil && r.lockOwner == args[0].(string) {
+				delete(d.rows, id.(int64))
+				affected++
+			}
+		}
+	default:
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ids []int64
+	for id := range d.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	result := &memRows{}
+	switch s.query {
+	case "SELECT id FROM gocent_outbox WHERE delivered_at = 0 AND locked_until < ? ORDER BY id LIMIT 100":
+		if err := checkArgs(s.query, args, "i"); err != nil {
+			return nil, err
+		}
+		result.columns = []string{"id"}
+		for _, id := range ids {
+			r := d.rows[id]
+			if r.deliveredAt == 0 && r.lockedUntil < args[0].(int64) && len(result.values) < 100 {
+				result.values = append(result.values, []driver.Value{id})
+			}
+		}
+	case "SELECT id, method, params FROM gocent_outbox WHERE lock_owner = ? AND locked_until = ? AND delivered_at = 0 ORDER BY id":
+		if err := checkArgs(s.query, args, "si"); err != nil {
+			return nil, err
+		}
+		result.columns = []string{"id", "method", "params"}
+		for _, id := range ids {
+			r := d.rows[id]
+			if r.deliveredAt == 0 && r.lockOwner == args[0].(string) && r.lockedUntil == args[1].(int64) {
+				result.values = append(result.values, []driver.Value{id, r.method, r.params})
+			}
+		}
+	default:
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	return result, nil
+}
+
+type memRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var memDriverSeq int
+
+func openMemDB(t *testing.T) (*sql.DB, *memDriver) {
+	d := &memDriver{rows: map[int64]*memRow{}}
+	memDriverSeq++
+	name := "gocent-mem-" + strconv.Itoa(memDriverSeq)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+func TestSQLOutboxRelay(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var cmd struct {
+				Params gocent.PublishOptions `json:"params"`
+			}
+			_ = json.Unmarshal(scanner.Bytes(), &cmd)
+			keys = append(keys, cmd.Params.IdempotencyKey)
+			_, _ = w.Write([]byte(`{"result":{}}` + "\n"))
+		}
+	}))
+	defer ts.Close()
+
+	db, d := openMemDB(t)
+	defer func() { _ = db.Close() }()
+	o, err := NewSQL(SQLConfig{
+		DB:         db,
+		Client:     gocent.New(gocent.Config{Addr: ts.URL}),
+		RetryDelay: time.Second,
+		ErrorHandler: func(err error) {
+			t.Errorf("unexpected relay error: %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clock advanced explicitly so retry delay does not depend on timing.
+	now := time.Now()
+	o.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Publish(ctx, tx, "test", []byte(`{}`), gocent.WithIdempotencyKey("key1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Broadcast(ctx, tx, []string{"a", "b"}, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := o.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("uncommitted rows must not be relayed: %d, %v", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, _ = db.Begin()
+	_ = o.Publish(ctx, tx, "test", []byte(`{}`))
+	_ = tx.Rollback()
+
+	if _, err := o.RelayOnce(ctx); err == nil {
+		t.Fatal("expected error from unavailable server")
+	}
+	if n, err := o.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("rows must not be retried before retry delay: %d, %v", n, err)
+	}
+	now = now.Add(time.Second + 1)
+	n, err := o.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 delivered rows, got %d", n)
+	}
+	if len(keys) != 2 || keys[0] != "key1" || keys[1] == "" {
+		t.Fatalf("unexpected idempotency keys: %v", keys)
+	}
+	for _, r := range d.rows {
+		if r.deliveredAt == 0 || r.attempts != 2 {
+			t.Fatalf("unexpected row state: %+v", r)
+		}
+	}
+	if n, err := o.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("delivered rows must not be relayed again: %d, %v", n, err)
+	}
+}
+
+func TestSQLOutboxDeleteDelivered(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{}}` + "\n"))
+	}))
+	defer ts.Close()
+	db, d := openMemDB(t)
+	defer func() { _ = db.Close() }()
+	o, err := NewSQL(SQLConfig{
+		DB:              db,
+		Client:          gocent.New(gocent.Config{Addr: ts.URL}),
+		DeleteDelivered: true,
+		ErrorHandler: func(err error) {
+			t.Errorf("unexpected relay error: %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tx, _ := db.Begin()
+	if err := o.Publish(ctx, tx, "test", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := o.RelayOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one delivered row: %d, %v", n, err)
+	}
+	if len(d.rows) != 0 {
+		t.Fatalf("expected delivered rows deleted, got %d", len(d.rows))
+	}
+}
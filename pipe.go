@@ -2,6 +2,7 @@ package gocent
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -9,6 +10,10 @@ import (
 type Pipe struct {
 	mu       sync.RWMutex
 	commands []Command
+	// channels when set used to validate channels of added commands.
+	channels *ChannelConfig
+	// tenant when set used to prefix channels of added commands.
+	tenant *tenantScope
 }
 
 // Reset allows to clear client command buffer.
@@ -18,7 +23,43 @@ func (p *Pipe) Reset() {
 	p.commands = nil
 }
 
+// AddCommand adds arbitrary Command to client command buffer. This is useful
+// to send commands which were previously built and serialized somewhere else.
+func (p *Pipe) AddCommand(cmd Command) error {
+	return p.add(cmd)
+}
+
+// Commands returns a copy of commands collected in Pipe.
+func (p *Pipe) Commands() []Command {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	commands := make([]Command, len(p.commands))
+	copy(commands, p.commands)
+	return commands
+}
+
 func (p *Pipe) add(cmd Command) error {
+	if p.channels != nil {
+		for _, ch := range commandChannels(cmd) {
+			if err := p.channels.Validate(ch); err != nil {
+				return err
+			}
+		}
+	}
+	if p.tenant != nil {
+		var err error
+		if cmd, err = p.tenant.command(cmd); err != nil {
+			return err
+		}
+		if p.channels != nil {
+			// Length limit applies to channels sent, with tenant prefix.
+			for _, ch := range commandChannels(cmd) {
+				if len(ch) > p.channels.maxLength() {
+					return ErrInvalidChannel{Channel: ch, Reason: fmt.Sprintf("longer than %d bytes", p.channels.maxLength())}
+				}
+			}
+		}
+	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.commands = append(p.commands, cmd)
@@ -143,13 +184,18 @@ func (p *Pipe) AddDisconnect(user string, opts ...DisconnectOption) error {
 	return p.add(cmd)
 }
 
+// channelRequest is params of commands which only need channel.
+type channelRequest struct {
+	Channel string `json:"channel"`
+}
+
 // AddPresence adds presence command to client command buffer but not actually
 // sends request to server until Pipe will be explicitly sent.
 func (p *Pipe) AddPresence(channel string) error {
 	cmd := Command{
 		Method: "presence",
-		Params: map[string]interface{}{
-			"channel": channel,
+		Params: channelRequest{
+			Channel: channel,
 		},
 	}
 	return p.add(cmd)
@@ -160,8 +206,8 @@ func (p *Pipe) AddPresence(channel string) error {
 func (p *Pipe) AddPresenceStats(channel string) error {
 	cmd := Command{
 		Method: "presence_stats",
-		Params: map[string]interface{}{
-			"channel": channel,
+		Params: channelRequest{
+			Channel: channel,
 		},
 	}
 	return p.add(cmd)
@@ -194,8 +240,8 @@ func (p *Pipe) AddHistory(channel string, opts ...HistoryOption) error {
 func (p *Pipe) AddHistoryRemove(channel string) error {
 	cmd := Command{
 		Method: "history_remove",
-		Params: map[string]interface{}{
-			"channel": channel,
+		Params: channelRequest{
+			Channel: channel,
 		},
 	}
 	return p.add(cmd)
@@ -221,12 +267,14 @@ func (p *Pipe) AddChannels(opts ...ChannelsOption) error {
 	return p.add(cmd)
 }
 
+type infoRequest struct{}
+
 // AddInfo adds info command to client command buffer but not actually
 // sends request to server until Pipe will be explicitly sent.
 func (p *Pipe) AddInfo() error {
 	cmd := Command{
 		Method: "info",
-		Params: map[string]interface{}{},
+		Params: infoRequest{},
 	}
 	return p.add(cmd)
 }
@@ -0,0 +1,259 @@
+package gocent
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PresenceEventType is a type of PresenceEvent.
+type PresenceEventType int
+
+const (
+	// PresenceJoin emitted when client appeared in channel presence.
+	PresenceJoin PresenceEventType = iota
+	// PresenceLeave emitted when client disappeared from channel presence.
+	PresenceLeave
+	// PresenceError emitted when presence of channel could not be loaded.
+	PresenceError
+)
+
+// PresenceEvent is emitted by PresenceWatcher.
+type PresenceEvent struct {
+	Type    PresenceEventType
+	Channel string
+	// Info of joined or left client.
+	Info ClientInfo
+	// Err set for PresenceError events.
+	Err error
+}
+
+// PresenceWatcherConfig of PresenceWatcher.
+type PresenceWatcherConfig struct {
+	// Interval between presence polls of the same channel. Zero value means 1s.
+	Interval time.Duration
+	// BatchSize is a maximum number of channels to ask presence for in one Pipe.
+	// Zero value means 100.
+	BatchSize int
+	// MaxRequestsPerSecond limits a number of Pipes sent per second.
+	// Zero value means no limit.
+	MaxRequestsPerSecond float64
+	// InitialJoins enables emitting PresenceJoin events for clients found in the
+	// first presence snapshot of a channel. By default first snapshot only used
+	// as a baseline.
+	InitialJoins bool
+	// BufferSize is a size of events channel buffer.
+	BufferSize int
+}
+
+// PresenceWatcher periodically loads presence of a set of channels and emits
+// join and leave events by comparing consecutive presence snapshots. Clients
+// which joined and left between two polls are not noticed.
+type PresenceWatcher struct {
+	client    *Client
+	config    PresenceWatcherConfig
+	mu        sync.Mutex
+	snapshots map[string]map[string]ClientInfo
+	events    chan PresenceEvent
+	lastSend  time.Time
+}
+
+// NewPresenceWatcher creates PresenceWatcher. Call Run to start polling.
+func NewPresenceWatcher(c *Client, config PresenceWatcherConfig) *PresenceWatcher {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &PresenceWatcher{
+		client:    c,
+		config:    config,
+		snapshots: map[string]map[string]ClientInfo{},
+		events:    make(chan PresenceEvent, config.BufferSize),
+	}
+}
+
+// Add starts watching channels. Safe to call concurrently with Run.
+func (w *PresenceWatcher) Add(channels ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range channels {
+		if _, ok := w.snapshots[ch]; !ok {
+			w.snapshots[ch] = nil
+		}
+	}
+}
+
+// Remove stops watching channels. No leave events emitted for clients of
+// removed channels. Safe to call concurrently with Run.
+func (w *PresenceWatcher) Remove(channels ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range channels {
+		delete(w.snapshots, ch)
+	}
+}
+
+// Channels returns watched channels.
+func (w *PresenceWatcher) Channels() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	channels := make([]string, 0, len(w.snapshots))
+	for ch := range w.snapshots {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Events returns channel with presence events. It's closed when Run returns.
+func (w *PresenceWatcher) Events() <-chan PresenceEvent {
+	return w.events
+}
+
+// Run polls presence until ctx done. Run must be called only once.
+func (w *PresenceWatcher) Run(ctx context.Context) error {
+	defer close(w.events)
+	for {
+		started := time.Now()
+		if err := w.poll(ctx); err != nil {
+			return err
+		}
+		timer := time.NewTimer(w.config.Interval - time.Since(started))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (w *PresenceWatcher) poll(ctx context.Context) error {
+	channels := w.Channels()
+	for start := 0; start < len(channels); start += w.config.BatchSize {
+		end := start + w.config.BatchSize
+		if end > len(channels) {
+			end = len(channels)
+		}
+		if err := w.pollBatch(ctx, channels[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *PresenceWatcher) pollBatch(ctx context.Context, channels []string) error {
+	if err := w.wait(ctx); err != nil {
+		return err
+	}
+	pipe := w.client.Pipe()
+	for _, ch := range channels {
+		_ = pipe.AddPresence(ch)
+	}
+	replies, err := w.client.SendPipe(ctx, pipe)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, ch := range channels {
+			if !w.emit(ctx, PresenceEvent{Type: PresenceError, Channel: ch, Err: err}) {
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+	for i, reply := range replies {
+		ch := channels[i]
+		if reply.Error != nil {
+			if !w.emit(ctx, PresenceEvent{Type: PresenceError, Channel: ch, Err: reply.Error}) {
+				return ctx.Err()
+			}
+			continue
+		}
+		result, err := decodePresence(reply.Result)
+		if err != nil {
+			if !w.emit(ctx, PresenceEvent{Type: PresenceError, Channel: ch, Err: err}) {
+				return ctx.Err()
+			}
+			continue
+		}
+		for _, event := range w.update(ch, result.Presence) {
+			if !w.emit(ctx, event) {
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// update saves new presence snapshot of channel and returns diff events.
+func (w *PresenceWatcher) update(channel string, presence map[string]ClientInfo) []PresenceEvent {
+	if presence == nil {
+		presence = map[string]ClientInfo{}
+	}
+	w.mu.Lock()
+	prev, ok := w.snapshots[channel]
+	if !ok {
+		// Channel removed while request was in flight.
+		w.mu.Unlock()
+		return nil
+	}
+	w.snapshots[channel] = presence
+	w.mu.Unlock()
+
+	if prev == nil && !w.config.InitialJoins {
+		return nil
+	}
+	var events []PresenceEvent
+	for _, id := range sortedClientIDs(presence) {
+		if _, ok := prev[id]; !ok {
+			events = append(events, PresenceEvent{Type: PresenceJoin, Channel: channel, Info: presence[id]})
+		}
+	}
+	for _, id := range sortedClientIDs(prev) {
+		if _, ok := presence[id]; !ok {
+			events = append(events, PresenceEvent{Type: PresenceLeave, Channel: channel, Info: prev[id]})
+		}
+	}
+	return events
+}
+
+// wait blocks to respect MaxRequestsPerSecond.
+func (w *PresenceWatcher) wait(ctx context.Context) error {
+	if w.config.MaxRequestsPerSecond <= 0 {
+		return nil
+	}
+	gap := time.Duration(float64(time.Second) / w.config.MaxRequestsPerSecond)
+	if d := gap - time.Since(w.lastSend); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	w.lastSend = time.Now()
+	return nil
+}
+
+func (w *PresenceWatcher) emit(ctx context.Context, event PresenceEvent) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sortedClientIDs(presence map[string]ClientInfo) []string {
+	ids := make([]string, 0, len(presence))
+	for id := range presence {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,86 @@
+package gocent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// presenceServer emulates Centrifugo presence of several channels.
+type presenceServer struct {
+	mu       sync.Mutex
+	presence map[string]map[string]ClientInfo
+}
+
+func (s *presenceServer) set(channel string, users ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := map[string]ClientInfo{}
+	for _, user := range users {
+		clients["client-"+user] = ClientInfo{User: user, Client: "client-" + user}
+	}
+	s.presence[channel] = clients
+}
+
+func (s *presenceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scanner := bufio.NewScanner(r.Body)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var cmd struct {
+			Params struct {
+				Channel string `json:"channel"`
+			} `json:"params"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &cmd)
+		data, _ := json.Marshal(PresenceResult{Presence: s.presence[cmd.Params.Channel]})
+		_ = enc.Encode(Reply{Result: data})
+	}
+}
+
+func TestPresenceWatcher(t *testing.T) {
+	srv := &presenceServer{presence: map[string]map[string]ClientInfo{}}
+	srv.set("a", "1")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	w := NewPresenceWatcher(New(Config{Addr: ts.URL}), PresenceWatcherConfig{
+		Interval:     time.Millisecond,
+		BatchSize:    1,
+		InitialJoins: true,
+	})
+	w.Add("a", "b")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { _ = w.Run(ctx) }()
+
+	next := func(typ PresenceEventType, channel, user string) {
+		t.Helper()
+		select {
+		case e := <-w.Events():
+			if e.Type != typ || e.Channel != channel || e.Info.User != user {
+				t.Fatalf("unexpected event: %+v", e)
+			}
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+
+	next(PresenceJoin, "a", "1")
+	srv.set("b", "2")
+	next(PresenceJoin, "b", "2")
+	srv.set("a")
+	next(PresenceLeave, "a", "1")
+
+	w.Remove("a")
+	w.Add("c")
+	srv.set("a", "3")
+	srv.set("c", "4")
+	next(PresenceJoin, "c", "4")
+}
@@ -59,6 +59,26 @@ type NodeInfo struct {
 	NumChannels int `json:"num_channels"`
 	// Uptime of node in seconds.
 	Uptime int `json:"uptime"`
+	// Metrics of node, nil if node has not exported metrics yet.
+	Metrics *Metrics `json:"metrics,omitempty"`
+	// Process statistics of node, nil if not available.
+	Process *Process `json:"process,omitempty"`
+}
+
+// Metrics contains node metrics aggregated over interval.
+type Metrics struct {
+	// Interval of metrics aggregation in seconds.
+	Interval float64 `json:"interval"`
+	// Items are metric values by name.
+	Items map[string]float64 `json:"items"`
+}
+
+// Process contains statistics of node process.
+type Process struct {
+	// CPU usage of process in percents.
+	CPU float64 `json:"cpu"`
+	// RSS is a resident set size of process in bytes.
+	RSS int64 `json:"rss"`
 }
 
 // InfoResult is a result of info command.
@@ -0,0 +1,314 @@
+package gocent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits rate of commands sent to Centrifugo. It's consulted
+// before every API call with all commands of request.
+type RateLimiter interface {
+	// Wait blocks until commands are allowed to be sent or returns error.
+	Wait(ctx context.Context, commands []Command) error
+}
+
+// ErrRateLimited returned when commands are not allowed to be sent due to
+// rate limit.
+type ErrRateLimited struct {
+	// Method of command which exceeded limit, empty for global limit.
+	Method string
+	// Channel which exceeded limit, empty if limit is not per channel.
+	Channel string
+	// RetryAfter is a time after which commands will be allowed.
+	RetryAfter time.Duration
+}
+
+func (e ErrRateLimited) Error() string {
+	scope := "global"
+	if e.Channel != "" {
+		scope = "channel " + e.Channel
+	} else if e.Method != "" {
+		scope = "method " + e.Method
+	}
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s", scope, e.RetryAfter)
+}
+
+// Rate is a token bucket configuration.
+type Rate struct {
+	// PerSecond is a number of commands allowed per second. Zero value means
+	// no limit.
+	PerSecond float64
+	// Burst is a maximum number of commands sent at once. Zero value means
+	// PerSecond rounded up (but at least 1).
+	Burst int
+}
+
+// RateLimitConfig configures TokenBucketLimiter. Every command consumes one
+// token from global bucket, bucket of its method and buckets of its channels.
+type RateLimitConfig struct {
+	// Global limits all commands.
+	Global Rate
+	// Methods contains limits per method name, like "publish" or "history".
+	Methods map[string]Rate
+	// Channel limits commands per channel, every channel has its own bucket.
+	// Broadcast consumes token from bucket of every channel.
+	Channel Rate
+	// FailFast makes Wait return ErrRateLimited immediately instead of
+	// waiting when limit exceeded. Note that in this mode Pipe with more
+	// commands than Burst is never allowed.
+	FailFast bool
+}
+
+// channelBucketsSweepInterval is a number of reservations after which idle
+// channel buckets are removed.
+const channelBucketsSweepInterval = 1024
+
+// TokenBucketLimiter is a RateLimiter based on token buckets.
+type TokenBucketLimiter struct {
+	config  RateLimitConfig
+	global  *tokenBucket
+	methods map[string]*tokenBucket
+
+	mu       sync.Mutex
+	channels map[string]*tokenBucket
+	reserved int
+}
+
+// NewRateLimiter creates TokenBucketLimiter.
+func NewRateLimiter(c RateLimitConfig) *TokenBucketLimiter {
+	l := &TokenBucketLimiter{
+		config:   c,
+		global:   newTokenBucket(c.Global),
+		methods:  make(map[string]*tokenBucket, len(c.Methods)),
+		channels: make(map[string]*tokenBucket),
+	}
+	for method, rate := range c.Methods {
+		if bucket := newTokenBucket(rate); bucket != nil {
+			l.methods[method] = bucket
+		}
+	}
+	return l
+}
+
+// reservation of tokens in bucket which can be cancelled.
+type reservation struct {
+	bucket  *tokenBucket
+	tokens  float64
+	delay   time.Duration
+	method  string
+	channel string
+}
+
+// Wait blocks until commands are allowed to be sent, ctx is done or returns
+// ErrRateLimited when FailFast is on or ctx deadline is before the time
+// commands are allowed.
+func (l *TokenBucketLimiter) Wait(ctx context.Context, commands []Command) error {
+	now := time.Now()
+	var reservations []reservation
+	reserve := func(bucket *tokenBucket, tokens float64, method, channel string) {
+		if bucket == nil || tokens == 0 {
+			return
+		}
+		delay := bucket.reserve(now, tokens)
+		reservations = append(reservations, reservation{bucket: bucket, tokens: tokens, delay: delay, method: method, channel: channel})
+	}
+
+	reserve(l.global, float64(len(commands)), "", "")
+	perMethod := make(map[string]float64)
+	perChannel := make(map[string]string)
+	channelTokens := make(map[string]float64)
+	for _, cmd := range commands {
+		perMethod[cmd.Method]++
+		if l.config.Channel.PerSecond > 0 {
+			for _, ch := range commandChannels(cmd) {
+				if ch == "" {
+					continue
+				}
+				channelTokens[ch]++
+				perChannel[ch] = cmd.Method
+			}
+		}
+	}
+	for method, tokens := range perMethod {
+		reserve(l.methods[method], tokens, method, "")
+	}
+	for ch, tokens := range channelTokens {
+		reserve(l.channelBucket(ch), tokens, perChannel[ch], ch)
+	}
+
+	var longest reservation
+	for _, r := range reservations {
+		if r.delay > longest.delay {
+			longest = r
+		}
+	}
+	if longest.delay == 0 {
+		return nil
+	}
+	cancel := func() {
+		for _, r := range reservations {
+			r.bucket.cancel(r.tokens)
+		}
+	}
+	limitErr := ErrRateLimited{Method: longest.method, Channel: longest.channel, RetryAfter: longest.delay}
+	if l.config.FailFast {
+		cancel()
+		return limitErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(longest.delay)) {
+		cancel()
+		return limitErr
+	}
+	timer := time.NewTimer(longest.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+func (l *TokenBucketLimiter) channelBucket(ch string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reserved++
+	if l.reserved%channelBucketsSweepInterval == 0 {
+		now := time.Now()
+		for name, bucket := range l.channels {
+			if bucket.idle(now) {
+				delete(l.channels, name)
+			}
+		}
+	}
+	bucket, ok := l.channels[ch]
+	if !ok {
+		bucket = newTokenBucket(l.config.Channel)
+		l.channels[ch] = bucket
+	}
+	return bucket
+}
+
+// tokenBucket allows tokens to go negative, so reservations made while
+// bucket is empty are served in order.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(r Rate) *tokenBucket {
+	if r.PerSecond <= 0 {
+		return nil
+	}
+	burst := float64(r.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(r.PerSecond))
+	}
+	return &tokenBucket{rate: r.PerSecond, burst: burst, tokens: burst}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// reserve takes tokens and returns time to wait before they are available.
+func (b *tokenBucket) reserve(now time.Time, tokens float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	b.tokens -= tokens
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns tokens of reservation which will not be used.
+func (b *tokenBucket) cancel(tokens float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+tokens)
+}
+
+// idle reports whether bucket is full, so it can be recreated when needed.
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.tokens >= b.burst
+}
+
+// commandChannels returns channels command is applied to. For commands
+// added with AddCommand channels are taken from "channel" and "channels"
+// fields of params.
+func commandChannels(cmd Command) []string {
+	switch params := cmd.Params.(type) {
+	case publishRequest:
+		return []string{params.Channel}
+	case broadcastRequest:
+		return params.Channels
+	case subscribeRequest:
+		return []string{params.Channel}
+	case unsubscribeRequest:
+		return []string{params.Channel}
+	case channelRequest:
+		return []string{params.Channel}
+	case historyRequest:
+		return []string{params.Channel}
+	case map[string]interface{}:
+		var channels []string
+		if ch, ok := params["channel"].(string); ok {
+			channels = append(channels, ch)
+		}
+		if chs, ok := params["channels"].([]interface{}); ok {
+			for _, ch := range chs {
+				if s, ok := ch.(string); ok {
+					channels = append(channels, s)
+				}
+			}
+		}
+		return channels
+	case json.RawMessage:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(params, &fields); err != nil {
+			return nil
+		}
+		return rawChannels(fields)
+	case map[string]json.RawMessage:
+		return rawChannels(params)
+	}
+	return nil
+}
+
+// rawChannels returns channels from "channel" and "channels" fields of
+// encoded params, values of other types are ignored.
+func rawChannels(fields map[string]json.RawMessage) []string {
+	var channels []string
+	var ch *string
+	if err := json.Unmarshal(fields["channel"], &ch); err == nil && ch != nil {
+		channels = append(channels, *ch)
+	}
+	var chs []*string
+	if err := json.Unmarshal(fields["channels"], &chs); err == nil {
+		for _, ch := range chs {
+			if ch != nil {
+				channels = append(channels, *ch)
+			}
+		}
+	}
+	return channels
+}
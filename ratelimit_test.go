@@ -0,0 +1,148 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEchoServer replies with empty result to every command.
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(strings.Repeat(`{"result":{}}`+"\n", bytes.Count(body, []byte("\n")))))
+	}))
+}
+
+func TestRateLimiterFailFast(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := New(Config{Addr: server.URL, RateLimiter: NewRateLimiter(RateLimitConfig{
+		Global:   Rate{PerSecond: 0.01, Burst: 5},
+		Methods:  map[string]Rate{"publish": {PerSecond: 0.01, Burst: 2}},
+		FailFast: true,
+	})})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Publish(ctx, "chat", []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := c.Publish(ctx, "chat", []byte(`{}`))
+	var limitErr ErrRateLimited
+	if !errors.As(err, &limitErr) || limitErr.Method != "publish" || limitErr.RetryAfter <= 0 {
+		t.Fatalf("expected publish rate limit error, got %v", err)
+	}
+
+	// Every command of pipe consumes token, rejected pipe does not.
+	pipe := c.Pipe()
+	for i := 0; i < 4; i++ {
+		_ = pipe.AddHistory("chat")
+	}
+	_, err = c.SendPipe(ctx, pipe)
+	if !errors.As(err, &limitErr) || limitErr.Method != "" {
+		t.Fatalf("expected global rate limit error, got %v", err)
+	}
+	pipe.Reset()
+	for i := 0; i < 3; i++ {
+		_ = pipe.AddHistory("chat")
+	}
+	if _, err := c.SendPipe(ctx, pipe); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Info(ctx); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+}
+
+func TestRateLimiterPerChannel(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := New(Config{Addr: server.URL, RateLimiter: NewRateLimiter(RateLimitConfig{
+		Channel:  Rate{PerSecond: 0.01, Burst: 1},
+		FailFast: true,
+	})})
+	ctx := context.Background()
+
+	for _, ch := range []string{"a", "b"} {
+		if _, err := c.Publish(ctx, ch, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var limitErr ErrRateLimited
+	if _, err := c.Publish(ctx, "a", []byte(`{}`)); !errors.As(err, &limitErr) || limitErr.Channel != "a" {
+		t.Fatalf("expected channel rate limit error, got %v", err)
+	}
+	if _, err := c.Broadcast(ctx, []string{"c", "d"}, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Broadcast(ctx, []string{"d", "e"}, []byte(`{}`)); !errors.As(err, &limitErr) || limitErr.Channel != "d" {
+		t.Fatalf("expected channel rate limit error, got %v", err)
+	}
+	// Token of rejected broadcast returned.
+	if _, err := c.Publish(ctx, "e", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Commands without channel not limited.
+	if _, err := c.Info(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Channels of raw commands limited too.
+	for _, params := range []interface{}{
+		json.RawMessage(`{"channel":"a","data":{}}`),
+		map[string]json.RawMessage{"channels": json.RawMessage(`["f","a"]`)},
+	} {
+		pipe := c.Pipe()
+		if err := pipe.AddCommand(Command{Method: "publish", Params: params}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SendPipe(ctx, pipe); !errors.As(err, &limitErr) || limitErr.Channel != "a" {
+			t.Fatalf("expected channel rate limit error for %v, got %v", params, err)
+		}
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := New(Config{Addr: server.URL, RateLimiter: NewRateLimiter(RateLimitConfig{
+		Global: Rate{PerSecond: 50, Burst: 1},
+	})})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Fatalf("expected requests to be delayed, took %s", elapsed)
+	}
+
+	c = New(Config{Addr: server.URL, RateLimiter: NewRateLimiter(RateLimitConfig{
+		Global: Rate{PerSecond: 1, Burst: 1},
+	})})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var limitErr ErrRateLimited
+	if _, err := c.Info(ctx); !errors.As(err, &limitErr) {
+		t.Fatalf("expected rate limit error for short deadline, got %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := c.Info(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// errorCodeAlreadySubscribed is returned by Centrifugo when user is already
+// subscribed to channel.
+const errorCodeAlreadySubscribed = 105
+
+// SubscriptionStore keeps server-side subscriptions of users applied by
+// Reconciler, for example in database next to membership data.
+type SubscriptionStore interface {
+	// Subscriptions returns current subscriptions of user by channel.
+	Subscriptions(ctx context.Context, user string) (map[string]SubscribeOptions, error)
+	// SetSubscriptions replaces subscriptions of user.
+	SetSubscriptions(ctx context.Context, user string, subscriptions map[string]SubscribeOptions) error
+}
+
+// MemorySubscriptionStore is a SubscriptionStore which keeps subscriptions in
+// memory, so state is lost on restart.
+type MemorySubscriptionStore struct {
+	mu    sync.RWMutex
+	users map[string]map[string]SubscribeOptions
+}
+
+// NewMemorySubscriptionStore creates MemorySubscriptionStore.
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return &MemorySubscriptionStore{users: make(map[string]map[string]SubscribeOptions)}
+}
+
+// Subscriptions returns copy of current subscriptions of user.
+func (s *MemorySubscriptionStore) Subscriptions(_ context.Context, user string) (map[string]SubscribeOptions, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copySubscriptions(s.users[user]), nil
+}
+
+// SetSubscriptions replaces subscriptions of user.
+func (s *MemorySubscriptionStore) SetSubscriptions(_ context.Context, user string, subscriptions map[string]SubscribeOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(subscriptions) == 0 {
+		delete(s.users, user)
+		return nil
+	}
+	s.users[user] = copySubscriptions(subscriptions)
+	return nil
+}
+
+func copySubscriptions(subscriptions map[string]SubscribeOptions) map[string]SubscribeOptions {
+	result := make(map[string]SubscribeOptions, len(subscriptions))
+	for ch, opts := range subscriptions {
+		result[ch] = opts
+	}
+	return result
+}
+
+// SubscriptionDiff contains changes required to get from current to desired
+// subscriptions, channels are sorted.
+type SubscriptionDiff struct {
+	// Subscribe contains channels user is not subscribed to yet.
+	Subscribe []string
+	// Unsubscribe contains channels user must not be subscribed to.
+	Unsubscribe []string
+	// Resubscribe contains channels with changed options, user is
+	// unsubscribed and subscribed again to apply them.
+	Resubscribe []string
+}
+
+// Empty checks whether diff contains no changes.
+func (d SubscriptionDiff) Empty() bool {
+	return len(d.Subscribe) == 0 && len(d.Unsubscribe) == 0 && len(d.Resubscribe) == 0
+}
+
+// DiffSubscriptions computes changes required to get from current to desired
+// subscriptions.
+func DiffSubscriptions(current, desired map[string]SubscribeOptions) SubscriptionDiff {
+	var diff SubscriptionDiff
+	for ch, opts := range desired {
+		currentOpts, ok := current[ch]
+		if !ok {
+			diff.Subscribe = append(diff.Subscribe, ch)
+		} else if !equalSubscribeOptions(currentOpts, opts) {
+			diff.Resubscribe = append(diff.Resubscribe, ch)
+		}
+	}
+	for ch := range current {
+		if _, ok := desired[ch]; !ok {
+			diff.Unsubscribe = append(diff.Unsubscribe, ch)
+		}
+	}
+	sort.Strings(diff.Subscribe)
+	sort.Strings(diff.Unsubscribe)
+	sort.Strings(diff.Resubscribe)
+	return diff
+}
+
+// equalSubscribeOptions compares options by their JSON encoding, so empty
+// and nil raw messages or equivalent JSON in raw messages are equal. Options
+// which can't be encoded are never equal.
+func equalSubscribeOptions(a, b SubscribeOptions) bool {
+	aData, err := normalizedJSON(a)
+	if err != nil {
+		return false
+	}
+	bData, err := normalizedJSON(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
+
+// normalizedJSON encodes v with object keys sorted and insignificant space
+// removed, numbers are kept as is.
+func normalizedJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// ReconcileResult describes changes applied by Reconciler.
+type ReconcileResult struct {
+	// Applied contains changes applied successfully.
+	Applied SubscriptionDiff
+	// Failed contains errors by channel for changes which were not applied.
+	Failed map[string]error
+	// Subscriptions are subscriptions of user after changes applied.
+	Subscriptions map[string]SubscribeOptions
+}
+
+// Reconciler keeps server-side subscriptions of users in sync with desired
+// state sending only required subscribe and unsubscribe commands.
+type Reconciler struct {
+	client *Client
+	store  SubscriptionStore
+	// locks serializes reconciliation of the same user.
+	mu    sync.Mutex
+	locks map[string]*userLock
+}
+
+type userLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewReconciler creates Reconciler. Nil store means MemorySubscriptionStore.
+func NewReconciler(c *Client, store SubscriptionStore) *Reconciler {
+	if store == nil {
+		store = NewMemorySubscriptionStore()
+	}
+	return &Reconciler{client: c, store: store, locks: make(map[string]*userLock)}
+}
+
+// Reconcile loads current subscriptions of user from store, applies changes
+// to get to desired subscriptions and saves resulting subscriptions to store.
+// Changes failed for some channels are reported in result and tried again
+// on next call, error returned only if request or store failed.
+func (r *Reconciler) Reconcile(ctx context.Context, user string, desired map[string]SubscribeOptions) (ReconcileResult, error) {
+	unlock := r.lock(user)
+	defer unlock()
+	current, err := r.store.Subscriptions(ctx, user)
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+	result, err := r.Apply(ctx, user, current, desired)
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+	if result.Applied.Empty() && len(result.Failed) == 0 {
+		return result, nil
+	}
+	if err := r.store.SetSubscriptions(ctx, user, result.Subscriptions); err != nil {
+		return ReconcileResult{}, err
+	}
+	return result, nil
+}
+
+// Apply sends changes required to get from current to desired subscriptions
+// of user without using store. Unsubscribes and new subscriptions are sent
+// in one Pipe, subscriptions with changed options are sent in second Pipe
+// to channels unsubscribed successfully. Subscribe to channel user already
+// subscribed to is considered successful.
+func (r *Reconciler) Apply(ctx context.Context, user string, current, desired map[string]SubscribeOptions) (ReconcileResult, error) {
+	diff := DiffSubscriptions(current, desired)
+	result := ReconcileResult{
+		Failed:        make(map[string]error),
+		Subscriptions: copySubscriptions(current),
+	}
+	if diff.Empty() {
+		return result, nil
+	}
+
+	type change struct {
+		method  string
+		channel string
+	}
+	var changes []change
+	pipe := r.client.Pipe()
+	add := func(method, ch string) {
+		var err error
+		if method == "subscribe" {
+			opts := desired[ch]
+			err = pipe.AddSubscribe(ch, user, func(o *SubscribeOptions) { *o = opts })
+		} else {
+			// Only client subscribed before is unsubscribed.
+			err = pipe.AddUnsubscribe(ch, user, WithUnsubscribeClient(current[ch].ClientID))
+		}
+		if err != nil {
+			result.Failed[ch] = err
+			return
+		}
+		changes = append(changes, change{method: method, channel: ch})
+	}
+	send := func() error {
+		defer func() { pipe, changes = r.client.Pipe(), nil }()
+		if len(changes) == 0 {
+			return nil
+		}
+		replies, err := r.client.SendPipe(ctx, pipe)
+		if err != nil {
+			return err
+		}
+		for i, c := range changes {
+			replyErr := replies[i].Error
+			if replyErr != nil && !(c.method == "subscribe" && replyErr.Code == errorCodeAlreadySubscribed) {
+				result.Failed[c.channel] = replyErr
+				continue
+			}
+			switch {
+			case c.method == "unsubscribe":
+				delete(result.Subscriptions, c.channel)
+				if _, ok := desired[c.channel]; !ok {
+					result.Applied.Unsubscribe = append(result.Applied.Unsubscribe, c.channel)
+				}
+			case hasKey(current, c.channel):
+				result.Subscriptions[c.channel] = desired[c.channel]
+				result.Applied.Resubscribe = append(result.Applied.Resubscribe, c.channel)
+			default:
+				result.Subscriptions[c.channel] = desired[c.channel]
+				result.Applied.Subscribe = append(result.Applied.Subscribe, c.channel)
+			}
+		}
+		return nil
+	}
+
+	for _, ch := range diff.Unsubscribe {
+		add("unsubscribe", ch)
+	}
+	for _, ch := range diff.Resubscribe {
+		add("unsubscribe", ch)
+	}
+	for _, ch := range diff.Subscribe {
+		add("subscribe", ch)
+	}
+	if err := send(); err != nil {
+		return ReconcileResult{}, err
+	}
+
+	// Old options kept when unsubscribe failed.
+	for _, ch := range diff.Resubscribe {
+		if _, failed := result.Failed[ch]; !failed {
+			add("subscribe", ch)
+		}
+	}
+	resubscribes := changes
+	if err := send(); err != nil {
+		// Unsubscribes applied already, subscribe tried again on next call.
+		for _, c := range resubscribes {
+			result.Failed[c.channel] = err
+		}
+	}
+	return result, nil
+}
+
+func hasKey(subscriptions map[string]SubscribeOptions, channel string) bool {
+	_, ok := subscriptions[channel]
+	return ok
+}
+
+func (r *Reconciler) lock(user string) func() {
+	r.mu.Lock()
+	l, ok := r.locks[user]
+	if !ok {
+		l = &userLock{}
+		r.locks[user] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		r.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(r.locks, user)
+		}
+		r.mu.Unlock()
+	}
+}
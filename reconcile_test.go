@@ -0,0 +1,173 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// subscriptionServer replies with already subscribed error for channel
+// "joined" and with permission denied error for channel "denied", keeps
+// received commands.
+type subscriptionServer struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (s *subscriptionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		var cmd struct {
+			Method string `json:"method"`
+			Params struct {
+				Channel  string `json:"channel"`
+				Presence bool   `json:"presence"`
+				Client   string `json:"client"`
+			} `json:"params"`
+		}
+		_ = json.Unmarshal(line, &cmd)
+		s.mu.Lock()
+		command := cmd.Method + " " + cmd.Params.Channel
+		if cmd.Params.Client != "" {
+			command += " " + cmd.Params.Client
+		}
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+		reply := `{"result":{}}`
+		switch {
+		case cmd.Method == "subscribe" && cmd.Params.Channel == "joined":
+			reply = `{"error":{"code":105,"message":"already subscribed"}}`
+		case cmd.Params.Channel == "denied":
+			reply = `{"error":{"code":103,"message":"permission denied"}}`
+		}
+		_, _ = w.Write([]byte(reply + "\n"))
+	}
+}
+
+func (s *subscriptionServer) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := s.commands
+	s.commands = nil
+	return commands
+}
+
+func TestDiffSubscriptions(t *testing.T) {
+	diff := DiffSubscriptions(
+		map[string]SubscribeOptions{"a": {}, "b": {}, "c": {Presence: true}},
+		map[string]SubscribeOptions{"b": {}, "c": {}, "e": {}, "d": {}},
+	)
+	expected := SubscriptionDiff{
+		Subscribe:   []string{"d", "e"},
+		Unsubscribe: []string{"a"},
+		Resubscribe: []string{"c"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, diff)
+	}
+	if !DiffSubscriptions(nil, nil).Empty() {
+		t.Fatal("expected empty diff")
+	}
+	diff = DiffSubscriptions(
+		map[string]SubscribeOptions{"a": {}, "b": {Info: json.RawMessage(`{"a":1,"b":[1,2]}`)}},
+		map[string]SubscribeOptions{"a": {Info: json.RawMessage{}}, "b": {Info: json.RawMessage(` { "b": [1, 2], "a": 1 }`)}},
+	)
+	if !diff.Empty() {
+		t.Fatalf("expected equivalent options unchanged, got %+v", diff)
+	}
+}
+
+func TestReconciler(t *testing.T) {
+	s := &subscriptionServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	store := NewMemorySubscriptionStore()
+	r := NewReconciler(New(Config{Addr: server.URL}), store)
+	ctx := context.Background()
+
+	result, err := r.Reconcile(ctx, "user", map[string]SubscribeOptions{
+		"a": {}, "joined": {}, "denied": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Applied.Subscribe, []string{"a", "joined"}) || len(result.Failed) != 1 || result.Failed["denied"] == nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if commands := s.take(); len(commands) != 3 {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+
+	// Failed subscription retried, nothing else sent.
+	_, err = r.Reconcile(ctx, "user", map[string]SubscribeOptions{
+		"a": {}, "joined": {}, "denied": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commands := s.take(); !reflect.DeepEqual(commands, []string{"subscribe denied"}) {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+
+	result, err = r.Reconcile(ctx, "user", map[string]SubscribeOptions{
+		"a": {Presence: true}, "b": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Subscribe with new options sent after unsubscribe succeeded.
+	expected := []string{"unsubscribe joined", "unsubscribe a", "subscribe b", "subscribe a"}
+	if commands := s.take(); !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("expected %v, got %v", expected, commands)
+	}
+	if !reflect.DeepEqual(result.Applied, SubscriptionDiff{
+		Subscribe:   []string{"b"},
+		Unsubscribe: []string{"joined"},
+		Resubscribe: []string{"a"},
+	}) {
+		t.Fatalf("unexpected applied changes %+v", result.Applied)
+	}
+	current, _ := store.Subscriptions(ctx, "user")
+	if !reflect.DeepEqual(current, map[string]SubscribeOptions{"a": {Presence: true}, "b": {}}) {
+		t.Fatalf("unexpected stored subscriptions %+v", current)
+	}
+
+	// Subscribe not sent when unsubscribe before resubscribe failed.
+	result, err = r.Apply(ctx, "user", map[string]SubscribeOptions{"denied": {}}, map[string]SubscribeOptions{"denied": {Presence: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commands := s.take(); !reflect.DeepEqual(commands, []string{"unsubscribe denied"}) {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+	if result.Failed["denied"] == nil || !reflect.DeepEqual(result.Subscriptions, map[string]SubscribeOptions{"denied": {}}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// Only subscribed client is unsubscribed.
+	_, err = r.Apply(ctx, "user",
+		map[string]SubscribeOptions{"a": {ClientID: "c1"}, "b": {ClientID: "c1"}},
+		map[string]SubscribeOptions{"a": {ClientID: "c2"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"unsubscribe b c1", "unsubscribe a c1", "subscribe a c2"}
+	if commands := s.take(); !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("expected %v, got %v", expected, commands)
+	}
+
+	// Nothing sent when state matches.
+	if _, err := r.Reconcile(ctx, "user", current); err != nil {
+		t.Fatal(err)
+	}
+	if commands := s.take(); len(commands) != 0 {
+		t.Fatalf("unexpected commands %v", commands)
+	}
+}
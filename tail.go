@@ -0,0 +1,302 @@
+package gocent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CheckpointStore persists stream position of tailed channel so Tail can
+// continue from it after restart.
+type CheckpointStore interface {
+	// Load returns saved position of channel or nil if there is no saved position.
+	Load(ctx context.Context, channel string) (*StreamPosition, error)
+	// Save stores position of channel.
+	Save(ctx context.Context, channel string, pos StreamPosition) error
+}
+
+// MemoryCheckpointStore is CheckpointStore which keeps positions in memory.
+type MemoryCheckpointStore struct {
+	mu        sync.Mutex
+	positions map[string]StreamPosition
+}
+
+// NewMemoryCheckpointStore creates MemoryCheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{positions: map[string]StreamPosition{}}
+}
+
+// Load returns position saved for channel.
+func (s *MemoryCheckpointStore) Load(_ context.Context, channel string) (*StreamPosition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[channel]
+	if !ok {
+		return nil, nil
+	}
+	return &pos, nil
+}
+
+// Save stores position of channel.
+func (s *MemoryCheckpointStore) Save(_ context.Context, channel string, pos StreamPosition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions[channel] = pos
+	return nil
+}
+
+// TailEventType is a type of TailEvent.
+type TailEventType int
+
+const (
+	// TailPublication emitted for every new publication in channel.
+	TailPublication TailEventType = iota
+	// TailGap emitted when publications between MissedFrom and MissedTo offsets
+	// were removed from history before Tail could read them.
+	TailGap
+	// TailEpochReset emitted when channel stream epoch changed. Tail then
+	// continues from the beginning of a new stream.
+	TailEpochReset
+	// TailError emitted on temporary errors, Tail keeps polling after them.
+	TailError
+)
+
+// TailEvent is emitted by Tail.
+type TailEvent struct {
+	Type TailEventType
+	// Publication set for TailPublication events.
+	Publication Publication
+	// Position in stream after event.
+	Position StreamPosition
+	// MissedFrom and MissedTo define a range of lost offsets for TailGap events.
+	MissedFrom uint64
+	MissedTo   uint64
+	// Err set for TailError events.
+	Err error
+}
+
+// TailOptions define some fields to alter Tail behaviour.
+type TailOptions struct {
+	// Since is a position to start tailing after. By default Tail only emits
+	// publications which appear after it started.
+	Since *StreamPosition
+	// PageSize is a maximum number of publications requested with one History call.
+	// Zero value means 100.
+	PageSize int
+	// MinInterval is a delay between polls when channel is active. Zero value
+	// means 100 milliseconds.
+	MinInterval time.Duration
+	// MaxInterval is a maximum delay between polls channel is idle. Zero value
+	// means 5 seconds, values less than MinInterval mean MinInterval.
+	MaxInterval time.Duration
+	// CheckpointStore to load initial position from and save positions to.
+	CheckpointStore CheckpointStore
+	// BufferSize is a size of events channel buffer.
+	BufferSize int
+}
+
+// TailOption is a type to represent various Tail options.
+type TailOption func(options *TailOptions)
+
+// WithTailSince allows to set TailOptions.Since.
+func WithTailSince(sp *StreamPosition) TailOption {
+	return func(opts *TailOptions) {
+		opts.Since = sp
+	}
+}
+
+// WithTailPageSize allows to set TailOptions.PageSize.
+func WithTailPageSize(size int) TailOption {
+	return func(opts *TailOptions) {
+		opts.PageSize = size
+	}
+}
+
+// WithTailInterval allows to set TailOptions.MinInterval and TailOptions.MaxInterval.
+func WithTailInterval(minInterval, maxInterval time.Duration) TailOption {
+	return func(opts *TailOptions) {
+		opts.MinInterval = minInterval
+		opts.MaxInterval = maxInterval
+	}
+}
+
+// WithCheckpointStore allows to set TailOptions.CheckpointStore.
+func WithCheckpointStore(store CheckpointStore) TailOption {
+	return func(opts *TailOptions) {
+		opts.CheckpointStore = store
+	}
+}
+
+// WithTailBufferSize allows to set TailOptions.BufferSize.
+func WithTailBufferSize(size int) TailOption {
+	return func(opts *TailOptions) {
+		opts.BufferSize = size
+	}
+}
+
+// Tail follows channel history stream by polling History and emits events to
+// returned channel until ctx done. Polling interval grows from MinInterval to
+// MaxInterval while channel is idle. If CheckpointStore provided Tail starts
+// from position loaded from it and saves position after every emitted event.
+func (c *Client) Tail(ctx context.Context, channel string, opts ...TailOption) (<-chan TailEvent, error) {
+	options := &TailOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.PageSize <= 0 {
+		options.PageSize = defaultHistoryPageSize
+	}
+	if options.MinInterval <= 0 {
+		options.MinInterval = 100 * time.Millisecond
+	}
+	if options.MaxInterval <= 0 {
+		options.MaxInterval = 5 * time.Second
+	}
+	if options.MaxInterval < options.MinInterval {
+		options.MaxInterval = options.MinInterval
+	}
+	var pos *StreamPosition
+	if options.Since != nil {
+		since := *options.Since
+		pos = &since
+	}
+	if options.CheckpointStore != nil {
+		saved, err := options.CheckpointStore.Load(ctx, channel)
+		if err != nil {
+			return nil, err
+		}
+		if saved != nil {
+			pos = saved
+		}
+	}
+	t := &tailer{
+		client:  c,
+		channel: channel,
+		options: options,
+		pos:     pos,
+		events:  make(chan TailEvent, options.BufferSize),
+	}
+	go t.run(ctx)
+	return t.events, nil
+}
+
+type tailer struct {
+	client  *Client
+	channel string
+	options *TailOptions
+	pos     *StreamPosition
+	events  chan TailEvent
+}
+
+func (t *tailer) run(ctx context.Context) {
+	defer close(t.events)
+	interval := t.options.MinInterval
+	for {
+		n, err := t.poll(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !t.emit(ctx, TailEvent{Type: TailError, Err: err}) {
+				return
+			}
+		}
+		var delay time.Duration
+		switch {
+		case err == nil && n >= t.options.PageSize:
+			interval = t.options.MinInterval
+			continue
+		case err == nil && n > 0:
+			interval = t.options.MinInterval
+			delay = interval
+		default:
+			delay = interval
+			interval *= 2
+			if interval > t.options.MaxInterval {
+				interval = t.options.MaxInterval
+			}
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// poll loads next history page and emits events, returns number of emitted publications.
+func (t *tailer) poll(ctx context.Context) (int, error) {
+	if t.pos == nil {
+		top, err := t.client.History(ctx, t.channel, WithLimit(0))
+		if err != nil {
+			return 0, err
+		}
+		t.pos = &StreamPosition{Offset: top.Offset, Epoch: top.Epoch}
+	}
+	result, err := t.client.History(ctx, t.channel, WithLimit(t.options.PageSize), WithSince(t.pos))
+	if err != nil {
+		var replyErr *Error
+		if errors.As(err, &replyErr) && replyErr.Code == errorCodeUnrecoverablePosition {
+			top, err := t.client.History(ctx, t.channel, WithLimit(0))
+			if err != nil {
+				return 0, err
+			}
+			return 0, t.resetEpoch(ctx, top.Epoch)
+		}
+		return 0, err
+	}
+	if t.pos.Epoch == "" {
+		t.pos.Epoch = result.Epoch
+	} else if result.Epoch != t.pos.Epoch {
+		return 0, t.resetEpoch(ctx, result.Epoch)
+	}
+	for _, pub := range result.Publications {
+		if expected := t.pos.Offset + 1; pub.Offset > expected {
+			t.pos.Offset = pub.Offset - 1
+			if err := t.emitAndSave(ctx, TailEvent{Type: TailGap, MissedFrom: expected, MissedTo: pub.Offset - 1}); err != nil {
+				return 0, err
+			}
+		}
+		t.pos.Offset = pub.Offset
+		if err := t.emitAndSave(ctx, TailEvent{Type: TailPublication, Publication: pub}); err != nil {
+			return 0, err
+		}
+	}
+	if len(result.Publications) == 0 && result.Offset > t.pos.Offset {
+		// All publications after our position already expired.
+		expected := t.pos.Offset + 1
+		t.pos.Offset = result.Offset
+		if err := t.emitAndSave(ctx, TailEvent{Type: TailGap, MissedFrom: expected, MissedTo: result.Offset}); err != nil {
+			return 0, err
+		}
+	}
+	return len(result.Publications), nil
+}
+
+func (t *tailer) resetEpoch(ctx context.Context, epoch string) error {
+	t.pos = &StreamPosition{Epoch: epoch}
+	return t.emitAndSave(ctx, TailEvent{Type: TailEpochReset})
+}
+
+func (t *tailer) emitAndSave(ctx context.Context, event TailEvent) error {
+	event.Position = *t.pos
+	if !t.emit(ctx, event) {
+		return ctx.Err()
+	}
+	if t.options.CheckpointStore != nil {
+		return t.options.CheckpointStore.Save(ctx, t.channel, *t.pos)
+	}
+	return nil
+}
+
+func (t *tailer) emit(ctx context.Context, event TailEvent) bool {
+	select {
+	case t.events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+package gocent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	srv := &historyServer{epoch: "a"}
+	srv.publish(3)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := New(Config{Addr: ts.URL})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store := NewMemoryCheckpointStore()
+	events, err := c.Tail(ctx, "test", WithTailSince(&StreamPosition{Offset: 3, Epoch: "a"}), WithTailPageSize(2), WithTailInterval(time.Millisecond, 5*time.Millisecond), WithCheckpointStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(expected TailEventType) TailEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != expected {
+				t.Fatalf("expected event type %d, got %+v", expected, e)
+			}
+			return e
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+		return TailEvent{}
+	}
+
+	srv.publish(3)
+	for offset := uint64(4); offset <= 6; offset++ {
+		if e := next(TailPublication); e.Publication.Offset != offset {
+			t.Fatalf("expected offset %d, got %d", offset, e.Publication.Offset)
+		}
+	}
+
+	srv.trim(9)
+	srv.publish(4)
+	if e := next(TailGap); e.MissedFrom != 7 || e.MissedTo != 8 {
+		t.Fatalf("unexpected gap: %+v", e)
+	}
+	next(TailPublication)
+	next(TailPublication)
+
+	srv.reset("b")
+	srv.publish(1)
+	if e := next(TailEpochReset); e.Position.Epoch != "b" {
+		t.Fatalf("unexpected reset position: %+v", e.Position)
+	}
+	if e := next(TailPublication); e.Publication.Offset != 1 {
+		t.Fatalf("unexpected publication after reset: %+v", e)
+	}
+	pos, _ := store.Load(ctx, "test")
+	if pos == nil || *pos != (StreamPosition{Offset: 1, Epoch: "b"}) {
+		t.Fatalf("unexpected checkpoint: %+v", pos)
+	}
+}
+
+func TestTailZeroOptions(t *testing.T) {
+	srv := &historyServer{epoch: "a"}
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	c := New(Config{Addr: ts.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := c.Tail(ctx, "test", WithTailPageSize(0), WithTailInterval(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	cancel()
+	for range events {
+	}
+	// Initial position request and polls with default 100ms interval.
+	if n := atomic.LoadInt32(&requests); n > 4 {
+		t.Fatalf("expected default poll interval, got %d requests", n)
+	}
+}
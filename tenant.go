@@ -0,0 +1,236 @@
+package gocent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ErrTenantEscape returned when command can't be scoped to tenant, for
+// example when its channels can't be found or Pipe belongs to other tenant.
+type ErrTenantEscape struct {
+	Tenant string
+	Method string
+	Reason string
+}
+
+func (e ErrTenantEscape) Error() string {
+	if e.Method == "" {
+		return fmt.Sprintf("tenant %q: %s", e.Tenant, e.Reason)
+	}
+	return fmt.Sprintf("tenant %q: %s: %s", e.Tenant, e.Method, e.Reason)
+}
+
+// TenantOptions define how channels are prefixed by WithTenant.
+type TenantOptions struct {
+	// Separator between tenant and channel. Zero value means ".".
+	Separator string
+}
+
+// TenantOption is a type to represent various WithTenant options.
+type TenantOption func(*TenantOptions)
+
+// WithTenantSeparator allows to set separator between tenant and channel.
+func WithTenantSeparator(separator string) TenantOption {
+	return func(opts *TenantOptions) {
+		opts.Separator = separator
+	}
+}
+
+// globChars are special in channels pattern so not allowed in tenant prefix.
+const globChars = `*?[]{}\`
+
+type tenantScope struct {
+	tenant string
+	prefix string
+	// err is set when tenant is invalid, all commands are rejected then.
+	err error
+}
+
+// WithTenant returns client view which prefixes channels of all commands
+// with tenant and separator ("acme.chat" for channel "chat" by default)
+// and strips prefix from channels results. Channels pattern is scoped
+// to tenant too, so only tenant channels returned. Commands which can't be
+// scoped and Pipes created by other client are rejected with ErrTenantEscape.
+// Client view shares transport and limiters with c. Calling WithTenant on
+// tenant view results into nested tenant.
+func (c *Client) WithTenant(tenant string, opts ...TenantOption) *Client {
+	options := &TenantOptions{Separator: "."}
+	for _, opt := range opts {
+		opt(options)
+	}
+	scope := &tenantScope{tenant: tenant, prefix: tenant + options.Separator}
+	switch {
+	case tenant == "":
+		scope.err = ErrTenantEscape{Tenant: tenant, Reason: "empty tenant"}
+	case options.Separator == "":
+		scope.err = ErrTenantEscape{Tenant: tenant, Reason: "empty separator"}
+	case strings.Contains(tenant, options.Separator):
+		scope.err = ErrTenantEscape{Tenant: tenant, Reason: "tenant contains separator"}
+	case strings.ContainsAny(scope.prefix, globChars):
+		scope.err = ErrTenantEscape{Tenant: tenant, Reason: "tenant contains pattern characters"}
+	}
+	if c.tenant != nil {
+		if c.tenant.err != nil {
+			scope.err = c.tenant.err
+		}
+		scope.tenant = c.tenant.tenant + options.Separator + scope.tenant
+		scope.prefix = c.tenant.prefix + scope.prefix
+	}
+	view := c.clone()
+	view.tenant = scope
+	return view
+}
+
+// Tenant returns tenant of client view, empty for client created with New.
+func (c *Client) Tenant() string {
+	if c.tenant == nil {
+		return ""
+	}
+	return c.tenant.tenant
+}
+
+func (s *tenantScope) escape(method, reason string) error {
+	return ErrTenantEscape{Tenant: s.tenant, Method: method, Reason: reason}
+}
+
+// channel returns channel prefixed with tenant.
+func (s *tenantScope) channel(method, channel string) (string, error) {
+	if channel == "" {
+		return "", s.escape(method, "empty channel")
+	}
+	return s.prefix + channel, nil
+}
+
+func (s *tenantScope) channelList(method string, channels []string) ([]string, error) {
+	scoped := make([]string, len(channels))
+	for i, ch := range channels {
+		var err error
+		if scoped[i], err = s.channel(method, ch); err != nil {
+			return nil, err
+		}
+	}
+	return scoped, nil
+}
+
+// pattern returns channels pattern which matches tenant channels only.
+func (s *tenantScope) pattern(pattern string) string {
+	if pattern == "" {
+		pattern = "*"
+	}
+	return s.prefix + pattern
+}
+
+// command returns copy of cmd with channels prefixed.
+func (s *tenantScope) command(cmd Command) (Command, error) {
+	if s.err != nil {
+		return Command{}, s.err
+	}
+	var err error
+	switch params := cmd.Params.(type) {
+	case publishRequest:
+		params.Channel, err = s.channel(cmd.Method, params.Channel)
+		cmd.Params = params
+	case broadcastRequest:
+		params.Channels, err = s.channelList(cmd.Method, params.Channels)
+		cmd.Params = params
+	case subscribeRequest:
+		params.Channel, err = s.channel(cmd.Method, params.Channel)
+		cmd.Params = params
+	case unsubscribeRequest:
+		params.Channel, err = s.channel(cmd.Method, params.Channel)
+		cmd.Params = params
+	case channelRequest:
+		params.Channel, err = s.channel(cmd.Method, params.Channel)
+		cmd.Params = params
+	case historyRequest:
+		params.Channel, err = s.channel(cmd.Method, params.Channel)
+		cmd.Params = params
+	case channelsRequest:
+		params.Pattern = s.pattern(params.Pattern)
+		cmd.Params = params
+	case disconnectRequest, infoRequest:
+	default:
+		// Commands added with AddCommand are scoped by known fields.
+		cmd.Params, err = s.params(cmd.Method, params)
+	}
+	if err != nil {
+		return Command{}, err
+	}
+	return cmd, nil
+}
+
+// params scopes arbitrary params of command, only fields known to contain
+// channels for method are allowed to reference channels. Other fields are
+// kept as is, so numbers are not converted to float64.
+func (s *tenantScope) params(method string, params interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, s.escape(method, "params must be an object")
+	}
+	switch method {
+	case "publish", "subscribe", "unsubscribe", "presence", "presence_stats", "history", "history_remove":
+		var channel string
+		if err := json.Unmarshal(fields["channel"], &channel); err != nil {
+			return nil, s.escape(method, "channel must be a string")
+		}
+		if channel, err = s.channel(method, channel); err != nil {
+			return nil, err
+		}
+		fields["channel"], err = json.Marshal(channel)
+	case "broadcast":
+		var channels []string
+		if err := json.Unmarshal(fields["channels"], &channels); err != nil || channels == nil {
+			return nil, s.escape(method, "channels must be a list of strings")
+		}
+		if channels, err = s.channelList(method, channels); err != nil {
+			return nil, err
+		}
+		fields["channels"], err = json.Marshal(channels)
+	case "channels":
+		var pattern *string
+		if raw, ok := fields["pattern"]; ok {
+			if err := json.Unmarshal(raw, &pattern); err != nil {
+				return nil, s.escape(method, "pattern must be a string")
+			}
+		}
+		if pattern == nil {
+			pattern = new(string)
+		}
+		fields["pattern"], err = json.Marshal(s.pattern(*pattern))
+	case "disconnect", "info":
+	default:
+		return nil, s.escape(method, "unknown method")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// reply strips tenant prefix from channels in reply to cmd.
+func (s *tenantScope) reply(cmd Command, rep Reply) (Reply, error) {
+	if cmd.Method != "channels" || rep.Error != nil || len(rep.Result) == 0 {
+		return rep, nil
+	}
+	var result ChannelsResult
+	if err := json.Unmarshal(rep.Result, &result); err != nil {
+		return rep, err
+	}
+	channels := make(map[string]ChannelInfo, len(result.Channels))
+	for ch, info := range result.Channels {
+		if strings.HasPrefix(ch, s.prefix) {
+			channels[strings.TrimPrefix(ch, s.prefix)] = info
+		}
+	}
+	data, err := json.Marshal(ChannelsResult{Channels: channels})
+	if err != nil {
+		return rep, err
+	}
+	rep.Result = data
+	return rep, nil
+}
@@ -0,0 +1,177 @@
+package gocent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingServer keeps params of received commands and replies to channels
+// command with channels of several tenants.
+type recordingServer struct {
+	mu     sync.Mutex
+	params []map[string]interface{}
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		var cmd struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		_ = json.Unmarshal(line, &cmd)
+		s.mu.Lock()
+		s.params = append(s.params, cmd.Params)
+		s.mu.Unlock()
+		if cmd.Method == "channels" {
+			_, _ = w.Write([]byte(`{"result":{"channels":{"acme.chat":{"num_users":1},"other.chat":{"num_users":2}}}}` + "\n"))
+			continue
+		}
+		_, _ = w.Write([]byte(`{"result":{}}` + "\n"))
+	}
+}
+
+func (s *recordingServer) last() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.params[len(s.params)-1]
+}
+
+func TestClientWithTenant(t *testing.T) {
+	rs := &recordingServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	c := New(Config{Addr: server.URL}).WithTenant("acme")
+	ctx := context.Background()
+
+	if _, err := c.Broadcast(ctx, []string{"a", "b"}, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if channels := rs.last()["channels"]; !reflect.DeepEqual(channels, []interface{}{"acme.a", "acme.b"}) {
+		t.Fatalf("unexpected broadcast channels %v", channels)
+	}
+	if _, err := c.History(ctx, "chat"); err != nil {
+		t.Fatal(err)
+	}
+	if channel := rs.last()["channel"]; channel != "acme.chat" {
+		t.Fatalf("unexpected history channel %v", channel)
+	}
+	if err := c.Subscribe(ctx, "chat", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if channel := rs.last()["channel"]; channel != "acme.chat" {
+		t.Fatalf("unexpected subscribe channel %v", channel)
+	}
+
+	result, err := c.Channels(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern := rs.last()["pattern"]; pattern != "acme.*" {
+		t.Fatalf("unexpected pattern %v", pattern)
+	}
+	if !reflect.DeepEqual(result.Channels, map[string]ChannelInfo{"chat": {NumUsers: 1}}) {
+		t.Fatalf("unexpected channels %v", result.Channels)
+	}
+	if _, err := c.Channels(ctx, WithPattern("ch*")); err != nil {
+		t.Fatal(err)
+	}
+	if pattern := rs.last()["pattern"]; pattern != "acme.ch*" {
+		t.Fatalf("unexpected pattern %v", pattern)
+	}
+
+	// Raw commands are scoped too.
+	pipe := c.Pipe()
+	if err := pipe.AddCommand(Command{Method: "presence", Params: json.RawMessage(`{"channel":"chat"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPipe(ctx, pipe); err != nil {
+		t.Fatal(err)
+	}
+	if channel := rs.last()["channel"]; channel != "acme.chat" {
+		t.Fatalf("unexpected presence channel %v", channel)
+	}
+
+	nested := c.WithTenant("eu")
+	if err := nested.Subscribe(ctx, "chat", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if channel := rs.last()["channel"]; channel != "acme.eu.chat" || nested.Tenant() != "acme.eu" {
+		t.Fatalf("unexpected nested tenant channel %v", channel)
+	}
+}
+
+func TestClientWithTenantEscape(t *testing.T) {
+	rs := &recordingServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	client := New(Config{Addr: server.URL})
+	c := client.WithTenant("acme")
+	ctx := context.Background()
+
+	var escape ErrTenantEscape
+	pipe := client.Pipe()
+	_ = pipe.AddPublish("other.chat", []byte(`{}`))
+	if _, err := c.SendPipe(ctx, pipe); !errors.As(err, &escape) {
+		t.Fatalf("expected escape error for pipe of other client, got %v", err)
+	}
+
+	pipe = c.Pipe()
+	testCases := []Command{
+		{Method: "publish", Params: map[string]interface{}{"data": map[string]interface{}{}}},
+		{Method: "broadcast", Params: map[string]interface{}{"channels": []interface{}{"a", 1}}},
+		{Method: "channels", Params: map[string]interface{}{"pattern": 1}},
+		{Method: "refresh", Params: map[string]interface{}{"user": "1"}},
+		{Method: "publish", Params: json.RawMessage(`[]`)},
+	}
+	for _, cmd := range testCases {
+		if err := pipe.AddCommand(cmd); !errors.As(err, &escape) {
+			t.Errorf("%s %v: expected escape error, got %v", cmd.Method, cmd.Params, err)
+		}
+	}
+	if err := pipe.AddPublish("", []byte(`{}`)); !errors.As(err, &escape) {
+		t.Fatalf("expected escape error for empty channel, got %v", err)
+	}
+	if len(pipe.Commands()) != 0 {
+		t.Fatal("rejected commands added to pipe")
+	}
+
+	for _, tenant := range []string{"", "a.b", "a*"} {
+		if _, err := client.WithTenant(tenant).Publish(ctx, "chat", []byte(`{}`)); !errors.As(err, &escape) {
+			t.Errorf("%q: expected invalid tenant error, got %v", tenant, err)
+		}
+	}
+	if len(rs.params) != 0 {
+		t.Fatal("unexpected requests sent")
+	}
+}
+
+func TestTenantParamsNumbers(t *testing.T) {
+	c := New(Config{}).WithTenant("acme")
+	pipe := c.Pipe()
+	for _, params := range []interface{}{
+		json.RawMessage(`{"channel":"chat","data":{"id":9007199254740993}}`),
+		map[string]interface{}{"channel": "chat", "data": map[string]interface{}{"id": int64(9007199254740993)}},
+	} {
+		if err := pipe.AddCommand(Command{Method: "publish", Params: params}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cmd := range pipe.Commands() {
+		data, err := json.Marshal(cmd.Params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := `{"channel":"acme.chat","data":{"id":9007199254740993}}`; string(data) != expected {
+			t.Fatalf("expected %s, got %s", expected, data)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package gocent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures TLS connections to Centrifugo using certificates
+// stored in files. Files are checked for modifications on every TLS handshake
+// and reloaded when changed, so rotated certificates are picked up without
+// restart. If reload fails (for example files are being rewritten) previously
+// loaded certificates are used until next successful reload.
+type TLSConfig struct {
+	// CAFile is a path to PEM encoded CA bundle to verify server certificate
+	// with. System roots used when empty.
+	CAFile string
+	// CertFile and KeyFile are paths to PEM encoded client certificate and key
+	// used for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides server name used to verify server certificate.
+	ServerName string
+	// MinVersion is a minimum TLS version, for example tls.VersionTLS13.
+	// Zero value means Go default for clients (TLS 1.2).
+	MinVersion uint16
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certStamp []fileStamp
+	pool      *x509.CertPool
+	poolStamp []fileStamp
+}
+
+// Validate checks that configured files exist and contain valid certificates.
+func (t *TLSConfig) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("both TLS cert file and key file must be set")
+	}
+	if t.CAFile != "" {
+		if _, err := loadCertPool(t.CAFile); err != nil {
+			return err
+		}
+	}
+	if t.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			return fmt.Errorf("error loading TLS key pair: %w", err)
+		}
+	}
+	return nil
+}
+
+// clientConfig returns tls.Config which loads certificates from files during
+// handshakes.
+func (t *TLSConfig) clientConfig() *tls.Config {
+	cfg := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: t.MinVersion,
+	}
+	if t.CertFile != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return t.certificate()
+		}
+	}
+	if t.CAFile != "" {
+		// Standard verification skipped because roots may change between
+		// handshakes, VerifyConnection does the same checks using CA bundle
+		// from file.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return t.verifyConnection(cs, cs.ServerName)
+		}
+	}
+	return cfg
+}
+
+// dialTLS returns function to dial TLS connections which verifies server
+// certificate against ServerName or host being dialed. Needed when CAFile
+// set since ConnectionState.ServerName is empty when dialing IP address.
+func (t *TLSConfig) dialTLS(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		name := t.ServerName
+		if name == "" {
+			name = host
+		}
+		cfg := t.clientConfig()
+		cfg.ServerName = name
+		if t.CAFile != "" {
+			cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+				return t.verifyConnection(cs, name)
+			}
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+func (t *TLSConfig) certificate() (*tls.Certificate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stamp := statFiles(t.CertFile, t.KeyFile)
+	if t.cert != nil && stampsEqual(stamp, t.certStamp) {
+		return t.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		if t.cert != nil {
+			return t.cert, nil
+		}
+		return nil, fmt.Errorf("error loading TLS key pair: %w", err)
+	}
+	t.cert, t.certStamp = &cert, stamp
+	return t.cert, nil
+}
+
+func (t *TLSConfig) certPool() (*x509.CertPool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stamp := statFiles(t.CAFile)
+	if t.pool != nil && stampsEqual(stamp, t.poolStamp) {
+		return t.pool, nil
+	}
+	pool, err := loadCertPool(t.CAFile)
+	if err != nil {
+		if t.pool != nil {
+			return t.pool, nil
+		}
+		return nil, err
+	}
+	t.pool, t.poolStamp = pool, stamp
+	return t.pool, nil
+}
+
+// verifyConnection verifies server certificate is issued for name, which
+// may be host name or IP address, by CA from CAFile.
+func (t *TLSConfig) verifyConnection(cs tls.ConnectionState, name string) error {
+	if name == "" {
+		return errors.New("unknown server name to verify certificate, set TLS ServerName")
+	}
+	pool, err := t.certPool()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       name,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading TLS CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in TLS CA file %s", path)
+	}
+	return pool, nil
+}
+
+// fileStamp changes when file is modified.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths ...string) []fileStamp {
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+func stampsEqual(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
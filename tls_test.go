@@ -0,0 +1,289 @@
+package gocent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T) *testCA {
+	cert, key := issueTestCert(t, nil, "Test CA", true)
+	return &testCA{cert: cert, key: key}
+}
+
+// issueTestCert creates certificate valid for 127.0.0.1 signed by ca, or
+// self-signed when ca is nil.
+// issueTestCert issues certificate for hosts, 127.0.0.1 when hosts empty.
+func issueTestCert(t *testing.T, ca *testCA, cn string, isCA bool, hosts ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"127.0.0.1"}
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func keyPEM(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// writeTestFile writes file and moves its modification time forward to make
+// sure change is noticed on file systems with coarse timestamps.
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	mtime := time.Now().Add(time.Duration(testSerial) * time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newMTLSServer starts server which requires client certificates signed by
+// ca and remembers common name of last client.
+func newMTLSServer(t *testing.T, serverCA, clientCA *testCA) (*httptest.Server, func() string) {
+	cert, key := issueTestCert(t, serverCA, "server", false)
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCA.cert)
+	var mu sync.Mutex
+	var clientName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	return server, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return clientName
+	}
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server, clientName := newMTLSServer(t, ca, ca)
+	defer server.Close()
+
+	dir := t.TempDir()
+	tlsConfig := &TLSConfig{
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		MinVersion: tls.VersionTLS13,
+	}
+	writeTestFile(t, tlsConfig.CAFile, certPEM(ca.cert))
+	cert, key := issueTestCert(t, ca, "client-1", false)
+	writeTestFile(t, tlsConfig.CertFile, certPEM(cert))
+	writeTestFile(t, tlsConfig.KeyFile, keyPEM(t, key))
+	if err := tlsConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(Config{Addr: server.URL, TLS: tlsConfig})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name := clientName(); name != "client-1" {
+		t.Fatalf("unexpected client certificate %q", name)
+	}
+
+	// Rotated certificate used for new connections.
+	cert, key = issueTestCert(t, ca, "client-2", false)
+	writeTestFile(t, tlsConfig.CertFile, certPEM(cert))
+	writeTestFile(t, tlsConfig.KeyFile, keyPEM(t, key))
+	c.httpClient.CloseIdleConnections()
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name := clientName(); name != "client-2" {
+		t.Fatalf("unexpected client certificate %q", name)
+	}
+
+	// Broken files do not affect previously loaded certificate.
+	writeTestFile(t, tlsConfig.KeyFile, []byte("broken"))
+	c.httpClient.CloseIdleConnections()
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTLSCAReload(t *testing.T) {
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	server, _ := newMTLSServer(t, newCA, newCA)
+	defer server.Close()
+
+	dir := t.TempDir()
+	tlsConfig := &TLSConfig{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+	}
+	writeTestFile(t, tlsConfig.CAFile, certPEM(oldCA.cert))
+	cert, key := issueTestCert(t, newCA, "client", false)
+	writeTestFile(t, tlsConfig.CertFile, certPEM(cert))
+	writeTestFile(t, tlsConfig.KeyFile, keyPEM(t, key))
+
+	c := New(Config{Addr: server.URL, TLS: tlsConfig})
+	if _, err := c.Info(context.Background()); err == nil {
+		t.Fatal("expected error for server certificate signed by unknown CA")
+	}
+	writeTestFile(t, tlsConfig.CAFile, certPEM(newCA.cert))
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTLSMinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{}}`))
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestFile(t, caFile, certPEM(server.Certificate()))
+
+	c := New(Config{Addr: server.URL, TLS: &TLSConfig{CAFile: caFile}})
+	if _, err := c.Info(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c = New(Config{Addr: server.URL, TLS: &TLSConfig{CAFile: caFile, MinVersion: tls.VersionTLS13}})
+	if _, err := c.Info(context.Background()); err == nil {
+		t.Fatal("expected error for server not supporting TLS 1.3")
+	}
+}
+
+func TestClientTLSServerName(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestFile(t, caFile, certPEM(ca.cert))
+
+	for _, host := range []string{"foo.test", "10.0.0.1"} {
+		cert, key := issueTestCert(t, ca, "server", false, host)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"result":{}}`))
+		}))
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		}
+		server.StartTLS()
+
+		// Certificate not issued for 127.0.0.1 must be rejected.
+		c := New(Config{Addr: server.URL, TLS: &TLSConfig{CAFile: caFile}})
+		if _, err := c.Info(context.Background()); err == nil {
+			t.Fatalf("expected certificate for %s rejected", host)
+		}
+
+		c = New(Config{Addr: server.URL, TLS: &TLSConfig{CAFile: caFile, ServerName: host}})
+		if _, err := c.Info(context.Background()); err != nil {
+			t.Fatalf("expected certificate for %s accepted: %v", host, err)
+		}
+		server.Close()
+	}
+}
+
+func TestClientTLSHandshakeCancel(t *testing.T) {
+	// Server accepts connections but never completes handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestFile(t, caFile, certPEM(ca.cert))
+	c := New(Config{Addr: "https://" + ln.Addr().String(), Timeout: time.Minute, TLS: &TLSConfig{CAFile: caFile}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Info(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("handshake not cancelled, took %s", elapsed)
+	}
+}